@@ -0,0 +1,55 @@
+package api
+
+import (
+	"nutshell/pkg"
+	"nutshell/pkg/nut"
+	"strings"
+)
+
+// badge - a flag of the UPS status shown as a chip, the severity is ok, warning or critical,
+// neutral for the flags unknown to nutshell
+type badge struct {
+	Code     string
+	Label    string
+	Severity string
+	// Title is the tooltip, e.g. the alarm text
+	Title string
+}
+
+// badges returns a chip per flag of the status code, e.g. Online and Charging for OL CHRG. The severity
+// of the flags is StatusSeverity, then the default one. The charger status replaces the CHRG and DISCHRG
+// flags when reported.
+func (s *Rest) badges(u UPS, status string) []badge {
+	var list []badge
+	charger, hasCharger := u.GetChargerStatus()
+	for _, code := range strings.Fields(status) {
+		if hasCharger && (code == "CHRG" || code == "DISCHRG") {
+			continue
+		}
+		label, ok := nut.NUTStatusHumanReadable[code]
+		if !ok {
+			list = append(list, badge{Code: code, Label: code, Severity: "neutral"})
+			continue
+		}
+		b := badge{Code: code, Label: label, Severity: s.severity(code)}
+		if code == "ALARM" {
+			b.Title, _ = u.GetAlarm()
+		}
+		list = append(list, b)
+	}
+	if hasCharger && len(list) > 0 {
+		list = append(list, badge{Code: charger, Label: nut.ChargerDescription(charger), Severity: "ok"})
+	}
+	return list
+}
+
+// severity returns the severity of the status flag, ok when it has none
+func (s *Rest) severity(code string) string {
+	if severity, ok := s.StatusSeverity[code]; ok {
+		return severity
+	}
+	if severity, ok := pkg.StatusSeverity[code]; ok {
+		return severity
+	}
+	return "ok"
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Nagios plugin states and their exit codes
+const (
+	checkOK       = "OK"
+	checkWarning  = "WARNING"
+	checkCritical = "CRITICAL"
+	checkUnknown  = "UNKNOWN"
+)
+
+var checkExitCodes = map[string]int{
+	checkOK:       0,
+	checkWarning:  1,
+	checkCritical: 2,
+	checkUnknown:  3,
+}
+
+// check returns the UPS state in the Nagios plugin format, e.g.
+// "UPS OK - battery=100% load=12% | battery=100;50;20 load=12". The state is also
+// set in the X-Nagios-Status and X-Nagios-Exit-Code headers.
+func (s *Rest) check(w http.ResponseWriter, r *http.Request) {
+	ups := s.findUPS(r.URL.Query().Get("ups"))
+	if ups == nil {
+		s.checkResult(w, http.StatusNotFound, checkUnknown, "UPS not found")
+		return
+	}
+
+	warn, crit := s.BatteryWarning, s.BatteryCritical
+	if v := r.URL.Query().Get("warn"); v != "" {
+		value, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			s.checkResult(w, http.StatusBadRequest, checkUnknown, fmt.Sprintf("invalid warn %q", v))
+			return
+		}
+		warn = value
+	}
+	if v := r.URL.Query().Get("crit"); v != "" {
+		value, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			s.checkResult(w, http.StatusBadRequest, checkUnknown, fmt.Sprintf("invalid crit %q", v))
+			return
+		}
+		crit = value
+	}
+
+	// the variables of a failed poll are the last known ones, the UPS may be on battery by now
+	if ups.Reconnecting() {
+		msg := "communication with the UPS lost"
+		if failures := ups.Failures(); failures.LastError != "" {
+			msg += ": " + failures.LastError
+		}
+		s.checkResult(w, http.StatusOK, checkCritical, msg)
+		return
+	}
+
+	_, status, _ := ups.GetStatus()
+	load, _, _ := ups.GetLoad()
+
+	flags := strings.Fields(status)
+	if !ups.Healthy() || len(flags) == 0 {
+		s.checkResult(w, http.StatusOK, checkUnknown, "status not available")
+		return
+	}
+
+	state := checkOK
+	raise := func(to string) {
+		if checkExitCodes[to] > checkExitCodes[state] {
+			state = to
+		}
+	}
+	for _, flag := range flags {
+		switch flag {
+		case "OB", "RB", "BYPASS", "OFF":
+			raise(checkWarning)
+		case "LB", "FSD", "OVER":
+			raise(checkCritical)
+		}
+	}
+	// the thresholds apply only to a reported charge, some UPSs report only the LB flag
+	battery, charged := ups.IntVar("battery.charge")
+	if charged && battery <= crit {
+		raise(checkCritical)
+	} else if charged && battery <= warn {
+		raise(checkWarning)
+	}
+
+	msg := fmt.Sprintf("status=%s", status)
+	if charged {
+		msg += fmt.Sprintf(" battery=%d%%", battery)
+	}
+	msg += fmt.Sprintf(" load=%d%%", load)
+	if latency := ups.GetPollLatency(); ups.SlowResponses() {
+		raise(checkWarning)
+		msg += fmt.Sprintf(" degraded - slow responses (p95 %s)", latency.P95.Round(time.Millisecond))
+	}
+	msg += " |"
+	if charged {
+		msg += fmt.Sprintf(" battery=%d;%d;%d", battery, warn, crit)
+	}
+	msg += fmt.Sprintf(" load=%d", load)
+	s.checkResult(w, http.StatusOK, state, msg)
+}
+
+func (s *Rest) checkResult(w http.ResponseWriter, code int, state, msg string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Nagios-Status", state)
+	w.Header().Set("X-Nagios-Exit-Code", strconv.Itoa(checkExitCodes[state]))
+	w.WriteHeader(code)
+	_, _ = fmt.Fprintf(w, "UPS %s - %s\n", state, msg)
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"nutshell/pkg/nut"
+	"strings"
+	"testing"
+)
+
+// failingUPS - the UPS whose last poll failed, with the variables read before
+type failingUPS struct {
+	*nut.UPS
+}
+
+func (u failingUPS) Healthy() bool      { return false }
+func (u failingUPS) Reconnecting() bool { return true }
+func (u failingUPS) Failures() nut.PollFailures {
+	return nut.PollFailures{Consecutive: 1, Total: 1, LastError: "connection refused"}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		ups   UPS
+		state string
+		body  string
+	}{
+		{name: "online", ups: fakeUPS("abc", "ups", "nut", map[string]string{"ups.status": "OL", "battery.charge": "100", "ups.load": "12"}),
+			state: checkOK, body: "battery=100;50;20 load=12"},
+		{name: "on battery", ups: fakeUPS("abc", "ups", "nut", map[string]string{"ups.status": "OB", "battery.charge": "90"}),
+			state: checkWarning, body: "battery=90%"},
+		{name: "low battery", ups: fakeUPS("abc", "ups", "nut", map[string]string{"ups.status": "OB LB", "battery.charge": "60"}),
+			state: checkCritical, body: "status=OB LB"},
+		{name: "failing poll", ups: failingUPS{fakeUPS("abc", "ups", "nut", map[string]string{"ups.status": "OL", "battery.charge": "100"})},
+			state: checkCritical, body: "communication with the UPS lost: connection refused"},
+		{name: "missing charge", ups: fakeUPS("abc", "ups", "nut", map[string]string{"ups.status": "OL", "ups.load": "12"}),
+			state: checkOK, body: "| load=12"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Rest{Providers: []Provider{&fakeProvider{name: "nut", upss: []UPS{tt.ups}}}, BatteryWarning: 50, BatteryCritical: 20}
+			w := httptest.NewRecorder()
+			s.check(w, httptest.NewRequest(http.MethodGet, "/api/v1/check?ups=abc", nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			if got := w.Header().Get("X-Nagios-Status"); got != tt.state {
+				t.Errorf("state = %s, want %s: %s", got, tt.state, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.body) {
+				t.Errorf("body = %q, want %q in it", w.Body, tt.body)
+			}
+		})
+	}
+}
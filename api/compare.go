@@ -0,0 +1,157 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"nutshell/pkg/nut"
+	"slices"
+	"strings"
+	"time"
+)
+
+// compareRow - a value of both UPSes in the compare view, Differ is set when the values are not the same
+type compareRow struct {
+	Name   string
+	A      string
+	B      string
+	InA    bool
+	InB    bool
+	Differ bool
+}
+
+// compareUPS - the UPS in the compare view
+type compareUPS struct {
+	ID     string
+	Label  string
+	Name   string
+	Server string
+	Model  string
+}
+
+// compare renders the key metrics and the variables of two UPSes side by side, the variables are diffed by name
+func (s *Rest) compare(w http.ResponseWriter, r *http.Request) {
+	a, b := s.findUPS(r.URL.Query().Get("a")), s.findUPS(r.URL.Query().Get("b"))
+	if a == nil || b == nil {
+		s.notFound(w, r)
+		return
+	}
+
+	metrics := func(u UPS) []string {
+		status, _, _ := u.GetStatus()
+		charge, _, _, _ := u.GetBattery()
+		load, power, _ := u.GetLoad()
+		runtime, _ := u.GetRuntime()
+		return []string{
+			status,
+			fmt.Sprintf("%d%%", charge),
+			fmt.Sprintf("%gV", u.GetBatteryVoltage().Value),
+			(time.Duration(runtime) * time.Second).String(),
+			fmt.Sprintf("%d%%", load),
+			fmt.Sprintf("%d W", power),
+			u.GetDriver().Name,
+		}
+	}
+	var keys []compareRow
+	metricsA, metricsB := metrics(a), metrics(b)
+	for i, name := range []string{"Status", "Battery charge", "Battery voltage", "Runtime", "Load", "Power", "Driver"} {
+		keys = append(keys, compareRow{
+			Name:   name,
+			A:      metricsA[i],
+			B:      metricsB[i],
+			InA:    true,
+			InB:    true,
+			Differ: metricsA[i] != metricsB[i],
+		})
+	}
+
+	variables, summary := diffVariables(a.LastVariables(), b.LastVariables())
+
+	data := struct {
+		A         compareUPS
+		B         compareUPS
+		Metrics   []compareRow
+		Variables []compareRow
+		Shared    int
+		OnlyA     int
+		OnlyB     int
+		Differ    int
+
+		Global string
+		Alert  string
+	}{
+		A:         s.compareUPS(r.URL.Query().Get("a"), a),
+		B:         s.compareUPS(r.URL.Query().Get("b"), b),
+		Metrics:   keys,
+		Variables: variables,
+		Shared:    summary.shared,
+		OnlyA:     summary.onlyA,
+		OnlyB:     summary.onlyB,
+		Differ:    summary.differ,
+	}
+	data.Global = overall(s.rows())
+	data.Alert = alert(data.Global)
+
+	if s.unavailable(w, s.Template.Compare) {
+		return
+	}
+	if err := s.Template.Compare.Execute(w, data); err != nil {
+		log.Printf("[ERROR] generate compare html: %v (request %s)", err, requestID(r))
+		http.Error(w, fmt.Sprintf("error generate compare html: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// compareUPS returns the header of the UPS, the id is the requested one to link to the group page for groups
+func (s *Rest) compareUPS(id string, u UPS) compareUPS {
+	device := u.Device()
+	return compareUPS{
+		ID:     id,
+		Label:  s.label(u).Label,
+		Name:   device.Name,
+		Server: u.ServerName(),
+		Model:  device.Manufacturer + " " + device.Model,
+	}
+}
+
+type diffSummary struct {
+	shared, onlyA, onlyB, differ int
+}
+
+// diffVariables returns the variables of both UPSes sorted by name, with the variables reported by one UPS only
+// and the shared variables with different values marked
+func diffVariables(a, b []nut.Variable) ([]compareRow, diffSummary) {
+	rows := map[string]*compareRow{}
+	for _, v := range a {
+		rows[v.Name] = &compareRow{Name: v.Name, A: v.Raw, InA: true}
+	}
+	for _, v := range b {
+		row, ok := rows[v.Name]
+		if !ok {
+			row = &compareRow{Name: v.Name}
+			rows[v.Name] = row
+		}
+		row.B, row.InB = v.Raw, true
+	}
+
+	var summary diffSummary
+	list := make([]compareRow, 0, len(rows))
+	for _, row := range rows {
+		switch {
+		case row.InA && row.InB:
+			summary.shared++
+			row.Differ = row.A != row.B
+			if row.Differ {
+				summary.differ++
+			}
+		case row.InA:
+			summary.onlyA++
+		default:
+			summary.onlyB++
+		}
+		list = append(list, *row)
+	}
+	slices.SortFunc(list, func(x, y compareRow) int {
+		return strings.Compare(x.Name, y.Name)
+	})
+	return list, summary
+}
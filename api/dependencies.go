@@ -0,0 +1,123 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// dependencyUPS - the UPS a client host depends on
+type dependencyUPS struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	Label    string  `json:"label"`
+	Location string  `json:"location,omitempty"`
+	Server   string  `json:"server"`
+	Status   string  `json:"status"`
+	State    string  `json:"state"`
+	Badges   []badge `json:"-"`
+}
+
+// dependencyHost - the client host and the UPSs it's connected to, usually the ones powering it
+type dependencyHost struct {
+	Host string          `json:"host"`
+	UPSs []dependencyUPS `json:"upss"`
+}
+
+// dependencyMap - the client hosts of all UPSs, and the UPSs without clients
+type dependencyMap struct {
+	Hosts     []dependencyHost `json:"hosts"`
+	NoClients []dependencyUPS  `json:"no_clients"`
+}
+
+// dependencyMap builds the map of the client hosts from the lists of clients of the UPSs refreshed with every poll.
+// A host connected to several UPSs is listed once with all of them.
+func (s *Rest) dependencyMap() dependencyMap {
+	m := dependencyMap{
+		Hosts:     []dependencyHost{},
+		NoClients: []dependencyUPS{},
+	}
+	hosts := map[string]*dependencyHost{}
+	for _, provider := range s.Providers {
+		if provider == nil {
+			continue
+		}
+		upss, err := s.upss(provider)
+		if err != nil {
+			continue
+		}
+		for _, u := range upss {
+			ups := s.dependencyUPS(u)
+			clients := u.ConnectedClients()
+			if len(clients) == 0 {
+				m.NoClients = append(m.NoClients, ups)
+				continue
+			}
+			for _, client := range clients {
+				host, ok := hosts[client]
+				if !ok {
+					host = &dependencyHost{Host: client}
+					hosts[client] = host
+				}
+				// a host with several connections to the UPS is listed several times by NUT
+				if slices.ContainsFunc(host.UPSs, func(d dependencyUPS) bool { return d.ID == ups.ID }) {
+					continue
+				}
+				host.UPSs = append(host.UPSs, ups)
+			}
+		}
+	}
+
+	for _, host := range hosts {
+		m.Hosts = append(m.Hosts, *host)
+	}
+	slices.SortFunc(m.Hosts, func(a, b dependencyHost) int {
+		return strings.Compare(a.Host, b.Host)
+	})
+	return m
+}
+
+func (s *Rest) dependencyUPS(u UPS) dependencyUPS {
+	status, originalStatus, _ := u.GetStatus()
+	label := s.label(u)
+	device := u.Device()
+	return dependencyUPS{
+		ID:       device.ID,
+		Name:     device.Name,
+		Label:    label.Label,
+		Location: label.Location,
+		Server:   u.ServerName(),
+		Status:   status,
+		State:    state(u.DebouncedStatus()),
+		Badges:   s.badges(u, originalStatus),
+	}
+}
+
+// dependencies returns the client hosts of all UPSs with the UPSs each of them depends on
+func (s *Rest) dependencies(w http.ResponseWriter, r *http.Request) {
+	s.json(w, s.dependencyMap())
+}
+
+// dependenciesPage renders the client hosts grouped with the UPSs protecting them
+func (s *Rest) dependenciesPage(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		dependencyMap
+
+		Global string
+		Alert  string
+	}{
+		dependencyMap: s.dependencyMap(),
+	}
+	data.Global = overall(s.rows())
+	data.Alert = alert(data.Global)
+
+	if s.unavailable(w, s.Template.Dependencies) {
+		return
+	}
+	if err := s.Template.Dependencies.Execute(w, data); err != nil {
+		log.Printf("[ERROR] generate dependencies html: %v (request %s)", err, requestID(r))
+		http.Error(w, fmt.Sprintf("error generate dependencies html: %v", err), http.StatusInternalServerError)
+	}
+}
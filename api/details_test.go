@@ -0,0 +1,44 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"nutshell/pkg"
+	"nutshell/pkg/nut"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDetailsEscapesDeviceValues(t *testing.T) {
+	// the templates are read from the root of the repository
+	t.Chdir("..")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	templates := &pkg.Template{FS: os.DirFS(".")}
+	if err := templates.Run(ctx); err != nil {
+		t.Fatalf("load templates: %v", err)
+	}
+
+	script := `<script>alert("ups")</script>`
+	ups := fakeUPS("abc", "ups", "nut", map[string]string{"ups.status": "OL", "ups.id": script, "device.model": `"><img src=x onerror=alert(1)>`})
+	ups.Description = script
+	ups.Commands = []nut.Command{{Name: "beeper.mute", Description: script}}
+	s := &Rest{Template: templates, Providers: []Provider{&fakeProvider{name: "nut", upss: []UPS{ups}}}, AllowWrite: true}
+
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/abc", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	body := rec.Body.String()
+	for _, raw := range []string{script, `"><img`} {
+		if strings.Contains(body, raw) {
+			t.Errorf("page contains the unescaped %s", raw)
+		}
+	}
+	if !strings.Contains(body, "&lt;script&gt;alert(&#34;ups&#34;)&lt;/script&gt;") {
+		t.Error("escaped description not rendered")
+	}
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// placeholderSerials are the serial numbers drivers report for devices without one, they don't identify the device
+var placeholderSerials = []string{"", "unknown", "none", "n/a", "na", "not set", "default"}
+
+// duplicateSet - the UPSs reported by several connections with the same vendor, model and serial number,
+// most likely the same server configured twice or two servers in front of the same device
+type duplicateSet struct {
+	Serial string
+	UPSs   []UPS
+}
+
+// Sources returns the UPSs of the set as name@host:port
+func (d duplicateSet) Sources() []string {
+	list := make([]string, 0, len(d.UPSs))
+	for _, u := range d.UPSs {
+		device := u.Device()
+		list = append(list, device.Name+"@"+device.Server)
+	}
+	return list
+}
+
+// deviceKey returns the vendor, model and serial number identifying the physical device, empty when
+// the serial number isn't reported or is a placeholder
+func deviceKey(u UPS) string {
+	serial, ok := u.StringVar("device.serial")
+	if !ok {
+		serial, _ = u.StringVar("ups.serial")
+	}
+	serial = strings.TrimSpace(serial)
+	if slices.Contains(placeholderSerials, strings.ToLower(serial)) || strings.Trim(serial, "0") == "" {
+		return ""
+	}
+
+	device := u.Device()
+	vendor, model := device.Manufacturer, device.Model
+	if value, ok := u.StringVar("device.mfr"); ok && vendor == "" {
+		vendor = value
+	}
+	if value, ok := u.StringVar("device.model"); ok && model == "" {
+		model = value
+	}
+	return strings.ToLower(fmt.Sprintf("%s|%s|%s", strings.TrimSpace(vendor), strings.TrimSpace(model), serial))
+}
+
+// duplicates returns the sets of the listed UPSs reporting the same device. The groups are configured
+// explicitly and aren't checked. Every set is logged once.
+func (s *Rest) duplicates(list []entry) []duplicateSet {
+	keys := map[string]*duplicateSet{}
+	var order []string
+	for _, e := range list {
+		if e.ID != e.UPS.Device().ID {
+			continue
+		}
+		key := deviceKey(e.UPS)
+		if key == "" {
+			continue
+		}
+		set, ok := keys[key]
+		if !ok {
+			serial, _ := e.UPS.StringVar("device.serial")
+			if serial == "" {
+				serial, _ = e.UPS.StringVar("ups.serial")
+			}
+			set = &duplicateSet{Serial: strings.TrimSpace(serial)}
+			keys[key] = set
+			order = append(order, key)
+		}
+		set.UPSs = append(set.UPSs, e.UPS)
+	}
+
+	var sets []duplicateSet
+	for _, key := range order {
+		set := keys[key]
+		if len(set.UPSs) < 2 {
+			continue
+		}
+		if _, warned := s.warnedDuplicates.LoadOrStore(key, true); !warned {
+			log.Printf("[WARN] %s report the same UPS with the serial number %s, the same server may be configured twice",
+				strings.Join(set.Sources(), ", "), set.Serial)
+		}
+		sets = append(sets, *set)
+	}
+	return sets
+}
+
+// mergeDuplicates replaces the UPSs of every duplicate set with a single entry of the healthiest member,
+// the most recently updated one among equally healthy, and returns the names of the merged sources by id
+func (s *Rest) mergeDuplicates(list []entry, sets []duplicateSet) ([]entry, map[string][]string) {
+	merged := map[string][]string{}
+	skip := map[UPS]bool{}
+	for _, set := range sets {
+		best := slices.MaxFunc(set.UPSs, func(a, b UPS) int {
+			if a.Healthy() != b.Healthy() {
+				if a.Healthy() {
+					return 1
+				}
+				return -1
+			}
+			return a.Updated().Compare(b.Updated())
+		})
+		id := best.Device().ID
+		for _, u := range set.UPSs {
+			if u != best {
+				skip[u] = true
+				device := u.Device()
+				merged[id] = append(merged[id], device.Name+"@"+device.Server)
+			}
+		}
+	}
+
+	result := make([]entry, 0, len(list))
+	for _, e := range list {
+		if e.ID == e.UPS.Device().ID && skip[e.UPS] {
+			continue
+		}
+		result = append(result, e)
+	}
+	return result, merged
+}
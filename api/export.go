@@ -0,0 +1,145 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// exportVariable - the variable with its metadata and allowed values
+type exportVariable struct {
+	Name          string       `json:"name"`
+	Value         any          `json:"value"`
+	Raw           string       `json:"raw"`
+	Type          string       `json:"type"`
+	OriginalType  string       `json:"original_type"`
+	Description   string       `json:"description"`
+	Writeable     bool         `json:"writeable"`
+	MaximumLength int          `json:"maximum_length,omitempty"`
+	Enums         []string     `json:"enums,omitempty"`
+	Ranges        [][2]float64 `json:"ranges,omitempty"`
+}
+
+// exportPoll - the poll failures of the UPS
+type exportPoll struct {
+	ConsecutiveFailures int64  `json:"consecutive_failures"`
+	TotalFailures       int64  `json:"total_failures"`
+	LastError           string `json:"last_error,omitempty"`
+}
+
+// exportCommand - the instant command allowed on the UPS
+type exportCommand struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// exportJSON - everything known about the UPS, see GET /api/v1/ups/{id}/export
+type exportJSON struct {
+	ExportedAt        time.Time        `json:"exported_at"`
+	Version           string           `json:"nutshell_version"`
+	ID                string           `json:"id"`
+	Name              string           `json:"name"`
+	Label             string           `json:"label"`
+	Location          string           `json:"location,omitempty"`
+	Description       string           `json:"description"`
+	Manufacturer      string           `json:"manufacturer"`
+	Model             string           `json:"model"`
+	VendorID          string           `json:"vendor_id,omitempty"`
+	ProductID         string           `json:"product_id,omitempty"`
+	Server            string           `json:"server"`
+	Address           string           `json:"address"`
+	Status            string           `json:"status"`
+	StatusDescription string           `json:"status_description"`
+	Role              string           `json:"role"`
+	Updated           time.Time        `json:"updated"`
+	Poll              exportPoll       `json:"poll"`
+	Variables         []exportVariable `json:"variables"`
+	Commands          []exportCommand  `json:"commands"`
+	Clients           []string         `json:"clients"`
+}
+
+// export returns everything known about the UPS as a JSON document to download, e.g. for a hardware bug
+// report or to compare identical units. The allowed values of writeable variables are read from the server.
+func (s *Rest) export(w http.ResponseWriter, r *http.Request) {
+	ups := s.findUPS(r.PathValue("id"))
+	if ups == nil {
+		s.jsonError(w, http.StatusNotFound, "UPS not found")
+		return
+	}
+	device := ups.Device()
+
+	last := ups.LastVariables()
+	variables := make([]exportVariable, 0, len(last))
+	for _, v := range last {
+		e := exportVariable{
+			Name:          v.Name,
+			Value:         v.Value,
+			Raw:           v.Raw,
+			Type:          v.Type,
+			OriginalType:  v.OriginalType,
+			Description:   v.Description,
+			Writeable:     v.Writeable,
+			MaximumLength: v.MaximumLength,
+		}
+		switch {
+		case v.Writeable && v.OriginalType == "ENUM":
+			enums, err := ups.GetVariableEnums(v.Name)
+			if err != nil {
+				log.Printf("[WARN] export %s: %v (request %s)", device.Name, err, requestID(r))
+			}
+			e.Enums = enums
+		case v.Writeable && v.OriginalType == "RANGE":
+			ranges, err := ups.GetVariableRanges(v.Name)
+			if err != nil {
+				log.Printf("[WARN] export %s: %v (request %s)", device.Name, err, requestID(r))
+			}
+			e.Ranges = ranges
+		}
+		variables = append(variables, e)
+	}
+	commands := make([]exportCommand, 0, len(ups.SupportedCommands()))
+	for _, c := range ups.SupportedCommands() {
+		if !s.commandAllowed(c.Name) {
+			continue
+		}
+		commands = append(commands, exportCommand{Name: c.Name, Description: c.Description})
+	}
+	clients := ups.ConnectedClients()
+	if clients == nil {
+		clients = []string{}
+	}
+
+	status, originalStatus, _ := ups.GetStatus()
+	failures := ups.Failures()
+	label := s.label(ups)
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.json"`, device.Name, time.Now().Format("20060102-150405")))
+	s.json(w, exportJSON{
+		ExportedAt:        time.Now().UTC(),
+		Version:           s.Version,
+		ID:                device.ID,
+		Name:              device.Name,
+		Label:             label.Label,
+		Location:          label.Location,
+		Description:       device.Description,
+		Manufacturer:      device.Manufacturer,
+		Model:             device.Model,
+		VendorID:          device.VendorID,
+		ProductID:         device.ProductID,
+		Server:            ups.ServerName(),
+		Address:           device.Server,
+		Status:            originalStatus,
+		StatusDescription: status,
+		Role:              ups.GetRole(),
+		Updated:           ups.Updated().UTC(),
+		Poll: exportPoll{
+			ConsecutiveFailures: failures.Consecutive,
+			TotalFailures:       failures.Total,
+			LastError:           failures.LastError,
+		},
+		Variables: variables,
+		Commands:  commands,
+		Clients:   clients,
+	})
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"nutshell/pkg/nut"
+	"time"
+)
+
+// extremeJSON - the extreme of a metric in the API, with the value in the documented unit
+type extremeJSON struct {
+	Value float64   `json:"value"`
+	Unit  string    `json:"unit"`
+	Time  time.Time `json:"time"`
+}
+
+// extremesJSON - the extremes of the UPS in the API, metrics never reported by the UPS are omitted
+type extremesJSON struct {
+	Since          time.Time    `json:"since"`
+	PeakLoad       *extremeJSON `json:"peak_load,omitempty"`
+	PeakPower      *extremeJSON `json:"peak_power,omitempty"`
+	MinRuntime     *extremeJSON `json:"min_runtime,omitempty"`
+	MinCharge      *extremeJSON `json:"min_charge,omitempty"`
+	MaxTemperature *extremeJSON `json:"max_temperature,omitempty"`
+}
+
+// extremeRow - the extreme of a metric on the details page, e.g. "78%" at "14:02"
+type extremeRow struct {
+	Title string
+	Value string
+	At    string
+}
+
+func (s *Rest) extremesJSON(e nut.Extremes) extremesJSON {
+	convert := func(extreme nut.Extreme, unit string) *extremeJSON {
+		if !extreme.Observed() {
+			return nil
+		}
+		return &extremeJSON{Value: round(extreme.Value, s.Precision), Unit: unit, Time: extreme.Time}
+	}
+	return extremesJSON{
+		Since:          e.Since,
+		PeakLoad:       convert(e.PeakLoad, "%"),
+		PeakPower:      convert(e.PeakPower, "W"),
+		MinRuntime:     convert(e.MinRuntime, "s"),
+		MinCharge:      convert(e.MinCharge, "%"),
+		MaxTemperature: convert(e.MaxTemperature, "°C"),
+	}
+}
+
+// extremeRows returns the observed extremes for the details page, the runtime is shown as a duration
+func extremeRows(e nut.Extremes) []extremeRow {
+	metrics := []struct {
+		title, unit string
+		extreme     nut.Extreme
+	}{
+		{"Peak load", "%", e.PeakLoad},
+		{"Peak power", "W", e.PeakPower},
+		{"Min runtime", "s", e.MinRuntime},
+		{"Min charge", "%", e.MinCharge},
+		{"Max temperature", "°C", e.MaxTemperature},
+	}
+	var rows []extremeRow
+	for _, m := range metrics {
+		if !m.extreme.Observed() {
+			continue
+		}
+		value := fmt.Sprintf("%g%s", m.extreme.Value, m.unit)
+		if m.unit == "s" {
+			value = (time.Duration(m.extreme.Value) * time.Second).String()
+		}
+		rows = append(rows, extremeRow{Title: m.title, Value: value, At: extremeTime(m.extreme.Time)})
+	}
+	return rows
+}
+
+// extremeTime formats the time of the extreme, the date is added when it's not today
+func extremeTime(t time.Time) string {
+	if t.Format(time.DateOnly) == time.Now().Format(time.DateOnly) {
+		return t.Format("15:04")
+	}
+	return t.Format("Jan 2 15:04")
+}
+
+// resetExtremes clears the extremes observed for the UPS
+func (s *Rest) resetExtremes(w http.ResponseWriter, r *http.Request) {
+	if !s.AllowWrite {
+		s.jsonError(w, http.StatusForbidden, "resetting the extremes is disabled")
+		return
+	}
+	ups := s.findUPS(r.PathValue("id"))
+	if ups == nil {
+		s.jsonError(w, http.StatusNotFound, "UPS not found")
+		return
+	}
+	ups.ResetExtremes()
+	log.Printf("[INFO] %s extremes reset (request %s)", ups.Device().Name, requestID(r))
+	s.json(w, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// faviconColors are the colors of the favicon by the overall status, the same as the header of the list
+var faviconColors = map[string]string{
+	"up":       "#47A417",
+	"degraded": "#E8AE01",
+	"down":     "#EE402E",
+	"unknown":  "#BEBEBE",
+}
+
+const faviconSVG = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24"><rect width="24" height="24" rx="5" fill="%s"/><path d="M13 3l-7 11h5l-1 7l7 -11h-5z" fill="#fff"/></svg>`
+
+// favicon returns the icon colored by the overall status, the pages pass the status they rendered
+// in ?status= so the icon matches the page, the current status is used without it
+func (s *Rest) favicon(w http.ResponseWriter, r *http.Request) {
+	color, ok := faviconColors[r.URL.Query().Get("status")]
+	if !ok {
+		color = faviconColors[overall(s.rows())]
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = fmt.Fprintf(w, faviconSVG, color)
+}
+
+// alert returns the prefix of the page title for the overall status, empty when there is nothing to notice
+func alert(status string) string {
+	switch status {
+	case "down":
+		return "⚠ On Battery"
+	case "degraded":
+		return "⚠ Degraded"
+	}
+	return ""
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"log"
+)
+
+// entry - UPS shown in the list, a group is shown as a single entry with its currently best member
+type entry struct {
+	ID    string
+	Label Label
+	UPS   UPS
+}
+
+// entries returns the UPSs of all providers with the members of each group replaced by the group
+func (s *Rest) entries() []entry {
+	var list []entry
+	for _, provider := range s.Providers {
+		if provider == nil {
+			continue
+		}
+		upss, err := s.upss(provider)
+		if err != nil {
+			// no UPSs while all of them are still loading is expected
+			if len(provider.Pending()) == 0 {
+				log.Printf("[ERROR] get UPSs for %s: %v", provider.Address(), err)
+			}
+			continue
+		}
+		for _, u := range upss {
+			if s.groupOf(u) != "" {
+				continue
+			}
+			list = append(list, entry{ID: u.Device().ID, Label: s.label(u), UPS: u})
+		}
+	}
+
+	for name := range s.Groups {
+		if u := s.resolveGroup(name); u != nil {
+			list = append(list, entry{ID: name, Label: s.groupLabel(name), UPS: u})
+		}
+	}
+
+	return list
+}
+
+// groupOf returns the name of the group the UPS belongs to, empty if none. Members are
+// configured by the UPS id or as name@host:port.
+func (s *Rest) groupOf(u UPS) string {
+	for name, members := range s.Groups {
+		for _, member := range members {
+			if device := u.Device(); member == device.ID || member == device.Name+"@"+device.Server {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// resolveGroup returns the first healthy member of the group in the configured order,
+// the first available member if none is healthy, nil for unknown group
+func (s *Rest) resolveGroup(name string) UPS {
+	var fallback UPS
+	for _, member := range s.Groups[name] {
+		for _, provider := range s.Providers {
+			if provider == nil {
+				continue
+			}
+			upss, err := s.upss(provider)
+			if err != nil {
+				continue
+			}
+			for _, u := range upss {
+				if device := u.Device(); member != device.ID && member != device.Name+"@"+device.Server {
+					continue
+				}
+				if u.Healthy() {
+					return u
+				}
+				if fallback == nil {
+					fallback = u
+				}
+			}
+		}
+	}
+	return fallback
+}
+
+// groupLabel returns the configured display metadata of the group, the label falls back to the group name
+func (s *Rest) groupLabel(name string) Label {
+	label := s.Labels[name]
+	if label.Label == "" {
+		label.Label = name
+	}
+	return label
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"nutshell/pkg/nut"
+	"path"
+	"slices"
+	"strings"
+)
+
+// maxVariableSeries limits the nut_ups_variable series of a single UPS, a broad MetricsVariables pattern
+// on a driver with hundreds of variables must not blow up the cardinality of the Prometheus server
+const maxVariableSeries = 50
+
+// statusFlags are the known flags of ups.status, each exported as a nut_ups_status series
+var statusFlags = slices.Sorted(maps.Keys(nut.NUTStatusHumanReadable))
+
+// labelEscaper escapes the label value as the Prometheus text format expects it, Go quoting escapes more
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// label formats the label of the series, e.g. ups="rack"
+func label(name, value string) string {
+	return name + `="` + labelEscaper.Replace(value) + `"`
+}
+
+// variableSeries - a numeric variable exported with MetricsVariables
+type variableSeries struct {
+	name  string
+	value float64
+}
+
+// metrics returns the state of UPSs in the Prometheus text format
+func (s *Rest) metrics(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	gauge := func(name, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	}
+
+	type upsMetrics struct {
+		labels   string
+		up       int
+		flags    []string
+		charge   int64
+		load     int64
+		power    int64
+		runtime  int64
+		voltage  float64
+		failures int64
+		// the electrical values not reported by the UPS are nil and skipped
+		current     *float64
+		apparent    *float64
+		powerFactor *float64
+		variables   []variableSeries
+		// expired hides the values, they are reported as NaN
+		expired bool
+	}
+	// value formats the value of the UPS metric, NaN when the values of the UPS expired
+	value := func(m upsMetrics, v any) string {
+		if m.expired {
+			return "NaN"
+		}
+		return fmt.Sprint(v)
+	}
+	var list []upsMetrics
+	for _, e := range s.entries() {
+		u := e.UPS
+		_, status, _ := u.GetStatus()
+		charge, _, voltage, _ := u.GetBattery()
+		load, power, _ := u.GetLoad()
+		runtime, _ := u.GetRuntime()
+
+		m := upsMetrics{
+			labels:   strings.Join([]string{label("ups", e.ID), label("name", u.Device().Name), label("server", u.Device().Server)}, ","),
+			flags:    strings.Fields(status),
+			charge:   charge,
+			load:     load,
+			power:    power,
+			runtime:  runtime,
+			voltage:  voltage,
+			failures: u.Failures().Total,
+			expired:  u.Expired(),
+		}
+		if value, err := u.GetCurrent(); err == nil {
+			m.current = &value
+		}
+		if value, err := u.GetApparentPower(); err == nil {
+			m.apparent = &value
+		}
+		if value, err := u.GetPowerFactor(); err == nil {
+			m.powerFactor = &value
+		}
+		m.variables = s.metricsVariables(u)
+		if state(status) == "up" {
+			m.up = 1
+		}
+		list = append(list, m)
+	}
+
+	gauge("nut_ups_up", "Whether the UPS is online (1) or not (0).")
+	for _, m := range list {
+		fmt.Fprintf(&b, "nut_ups_up{%s} %d\n", m.labels, m.up)
+	}
+	gauge("nut_ups_status", "Whether the flag is set in the status of the UPS (1) or not (0), the flags not known are reported when set.")
+	for _, m := range list {
+		flags := slices.Clone(statusFlags)
+		for _, flag := range m.flags {
+			if !slices.Contains(flags, flag) {
+				flags = append(flags, flag)
+			}
+		}
+		for _, flag := range flags {
+			set := 0
+			if slices.Contains(m.flags, flag) {
+				set = 1
+			}
+			fmt.Fprintf(&b, "nut_ups_status{%s,%s} %s\n", m.labels, label("flag", flag), value(m, set))
+		}
+	}
+	gauge("nut_ups_battery_charge_percent", "Battery charge in percent.")
+	for _, m := range list {
+		fmt.Fprintf(&b, "nut_ups_battery_charge_percent{%s} %s\n", m.labels, value(m, m.charge))
+	}
+	gauge("nut_ups_battery_voltage_volts", "Battery voltage in volts.")
+	for _, m := range list {
+		fmt.Fprintf(&b, "nut_ups_battery_voltage_volts{%s} %s\n", m.labels, value(m, m.voltage))
+	}
+	gauge("nut_ups_battery_runtime_seconds", "Remaining battery runtime in seconds.")
+	for _, m := range list {
+		fmt.Fprintf(&b, "nut_ups_battery_runtime_seconds{%s} %s\n", m.labels, value(m, m.runtime))
+	}
+	gauge("nut_ups_load_percent", "Load in percent of the UPS capacity.")
+	for _, m := range list {
+		fmt.Fprintf(&b, "nut_ups_load_percent{%s} %s\n", m.labels, value(m, m.load))
+	}
+	gauge("nut_ups_power_watts", "Power drawn by the load in watts.")
+	for _, m := range list {
+		fmt.Fprintf(&b, "nut_ups_power_watts{%s} %s\n", m.labels, value(m, m.power))
+	}
+	optional := func(name, help string, value func(m upsMetrics) *float64) {
+		var header bool
+		for _, m := range list {
+			if value(m) == nil {
+				continue
+			}
+			if !header {
+				gauge(name, help)
+				header = true
+			}
+			fmt.Fprintf(&b, "%s{%s} %g\n", name, m.labels, *value(m))
+		}
+	}
+	optional("nut_ups_output_current_amperes", "Output current in amperes.", func(m upsMetrics) *float64 { return m.current })
+	optional("nut_ups_apparent_power_voltamperes", "Apparent power of the load in volt-amperes.", func(m upsMetrics) *float64 { return m.apparent })
+	optional("nut_ups_power_factor", "Output power factor between 0 and 1.", func(m upsMetrics) *float64 { return m.powerFactor })
+	var header bool
+	for _, m := range list {
+		for _, v := range m.variables {
+			if !header {
+				gauge("nut_ups_variable", "Numeric UPS variable selected with METRICS_VARIABLES.")
+				header = true
+			}
+			fmt.Fprintf(&b, "nut_ups_variable{%s,%s} %g\n", m.labels, label("variable", v.name), v.value)
+		}
+	}
+	fmt.Fprintf(&b, "# HELP nut_ups_poll_failures_total Failed polls of the UPS.\n# TYPE nut_ups_poll_failures_total counter\n")
+	for _, m := range list {
+		fmt.Fprintf(&b, "nut_ups_poll_failures_total{%s} %d\n", m.labels, m.failures)
+	}
+
+	// the traffic with each NUT server, e.g. to see the cost of the polling
+	counter := func(name, help string, value func(nut.Stats) int64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+		for _, provider := range s.Providers {
+			if provider != nil {
+				fmt.Fprintf(&b, "%s{%s} %d\n", name, label("server", provider.Name()), value(provider.Stats()))
+			}
+		}
+	}
+	counter("nut_server_commands_total", "Commands sent to the NUT server.", func(st nut.Stats) int64 { return st.Commands })
+	counter("nut_server_command_errors_total", "Commands to the NUT server failed, including errors reported by the server.", func(st nut.Stats) int64 { return st.Errors })
+	counter("nut_server_sent_bytes_total", "Bytes sent to the NUT server.", func(st nut.Stats) int64 { return st.BytesSent })
+	counter("nut_server_received_bytes_total", "Bytes received from the NUT server.", func(st nut.Stats) int64 { return st.BytesReceived })
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// metricsVariables returns the numeric variables matching MetricsVariables, at most maxVariableSeries.
+// Nothing is exported by default, the curated series above cover the usual dashboards.
+func (s *Rest) metricsVariables(u UPS) []variableSeries {
+	if len(s.MetricsVariables) == 0 {
+		return nil
+	}
+	var list []variableSeries
+	for _, v := range u.CurrentVariables() {
+		if len(list) == maxVariableSeries {
+			break
+		}
+		if !s.metricsVariable(v.Name) {
+			continue
+		}
+		value, ok := u.FloatVar(v.Name)
+		if !ok {
+			continue
+		}
+		list = append(list, variableSeries{name: v.Name, value: value})
+	}
+	return list
+}
+
+func (s *Rest) metricsVariable(name string) bool {
+	for _, pattern := range s.MetricsVariables {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
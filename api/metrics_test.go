@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLabel(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "rack", want: `ups="rack"`},
+		{value: `rack "A"`, want: `ups="rack \"A\""`},
+		{value: `C:\ups`, want: `ups="C:\\ups"`},
+		{value: "line\nbreak", want: `ups="line\nbreak"`},
+		// Go quoting would escape these, the exposition format keeps them as is
+		{value: "tab\there", want: "ups=\"tab\there\""},
+		{value: "zürich", want: `ups="zürich"`},
+	}
+	for _, tt := range tests {
+		if got := label("ups", tt.value); got != tt.want {
+			t.Errorf("label(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	ups := fakeUPS(`rack"1`, `rack\ups`, "nut:3493", map[string]string{"ups.status": "OL CHRG XYZ", "battery.charge": "87"})
+	s := &Rest{Providers: []Provider{&fakeProvider{name: "nut", upss: []UPS{ups}}}}
+
+	w := httptest.NewRecorder()
+	s.metrics(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+
+	labels := `ups="rack\"1",name="rack\\ups",server="nut:3493"`
+	for _, line := range []string{
+		`nut_ups_up{` + labels + `} 1`,
+		`nut_ups_status{` + labels + `,flag="OL"} 1`,
+		`nut_ups_status{` + labels + `,flag="CHRG"} 1`,
+		`nut_ups_status{` + labels + `,flag="OB"} 0`,
+		`nut_ups_status{` + labels + `,flag="XYZ"} 1`,
+		`nut_ups_battery_charge_percent{` + labels + `} 87`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("no %s in\n%s", line, body)
+		}
+	}
+	for _, line := range strings.Split(body, "\n") {
+		if strings.Contains(line, "status=") {
+			t.Errorf("status label in %s", line)
+		}
+	}
+}
@@ -1,17 +1,18 @@
 package api
 
 import (
-	"fmt"
+	"log"
 	"net/http"
-	"os"
+	"net/url"
 	"runtime/debug"
+	"strings"
 )
 
 func Recoverer(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if rvr := recover(); rvr != nil && rvr != http.ErrAbortHandler {
-				_, _ = fmt.Fprintf(os.Stderr, "Panic: %+v\n", rvr)
+				log.Printf("[ERROR] panic in %s %s: %+v (request %s)", r.Method, r.URL.Path, rvr, requestID(r))
 				debug.PrintStack()
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			}
@@ -20,17 +21,101 @@ func Recoverer(next http.Handler) http.Handler {
 	})
 }
 
-func CORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
+// CORS allows cross-origin requests from the listed origins only. The listed origins are reflected and allowed
+// to send credentials, "*" allows any other origin without credentials, as browsers refuse credentials with "*".
+// Requests from other origins get no CORS headers, and their preflight requests are rejected.
+func CORS(origins []string) func(http.Handler) http.Handler {
+	allowed := allowedOrigins(origins)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			listed := origin != "" && allowed[origin]
+			ok := listed || origin != "" && allowed["*"]
+			if origin != "" {
+				w.Header().Add("Vary", "Origin")
+			}
+			if listed {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			} else if ok {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			}
+			if ok {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, "+requestIDHeader)
+				w.Header().Set("Access-Control-Expose-Headers", requestIDHeader)
+			}
+			if r.Method == http.MethodOptions {
+				if !ok {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SameOrigin rejects the requests changing the state (other than GET, HEAD and OPTIONS) sent by other sites,
+// e.g. a form of another page posting to the API with the cookies of the user. A request is forbidden when its Origin
+// is another host not allowed by origins, like in CORS, or when the browser marks it cross-site by Sec-Fetch-Site
+// without an Origin. The requests must be JSON even without a body: other sites can post forms and plain text
+// without a preflight request, also from browsers sending neither header.
+func SameOrigin(origins []string) func(http.Handler) http.Handler {
+	allowed := allowedOrigins(origins)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+			origin := r.Header.Get("Origin")
+			forbidden := origin == "" && r.Header.Get("Sec-Fetch-Site") == "cross-site"
+			if origin != "" && !allowed[origin] && !allowed["*"] {
+				u, err := url.Parse(origin)
+				forbidden = err != nil || u.Host != r.Host
+			}
+			if forbidden {
+				log.Printf("[WARN] rejected cross-site %s %s from %q (request %s)", r.Method, r.URL.Path, origin, requestID(r))
+				http.Error(w, "cross-site requests are not allowed", http.StatusForbidden)
+				return
+			}
+			if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+				http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// allowedOrigins returns the set of the origins from the configuration, without the trailing slashes
+func allowedOrigins(origins []string) map[string]bool {
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowed[strings.TrimSuffix(strings.TrimSpace(origin), "/")] = true
+	}
+	return allowed
+}
+
+// SecurityHeaders sets the Content-Security-Policy returned by csp and the headers preventing content sniffing
+// and leaking the URL in the referrer. With frameOptions, framing by other sites is denied by X-Frame-Options too,
+// it must be disabled for a policy allowing embedding with frame-ancestors.
+func SecurityHeaders(csp func() string, frameOptions bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Security-Policy", csp())
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.Header().Set("Referrer-Policy", "same-origin")
+			if frameOptions {
+				w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
 func Healthz(next http.Handler) http.Handler {
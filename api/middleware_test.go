@@ -0,0 +1,100 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     []string
+		method      string
+		origin      string
+		status      int
+		allowOrigin string
+		credentials string
+	}{
+		{name: "listed", origins: []string{"https://a.example/"}, method: http.MethodGet, origin: "https://a.example",
+			status: http.StatusOK, allowOrigin: "https://a.example", credentials: "true"},
+		{name: "not listed", origins: []string{"https://a.example"}, method: http.MethodGet, origin: "https://b.example",
+			status: http.StatusOK},
+		{name: "any", origins: []string{"*"}, method: http.MethodGet, origin: "https://b.example",
+			status: http.StatusOK, allowOrigin: "*"},
+		{name: "listed with any", origins: []string{"*", "https://a.example"}, method: http.MethodGet, origin: "https://a.example",
+			status: http.StatusOK, allowOrigin: "https://a.example", credentials: "true"},
+		{name: "same origin", origins: []string{"*"}, method: http.MethodGet, status: http.StatusOK},
+		{name: "preflight any", origins: []string{"*"}, method: http.MethodOptions, origin: "https://b.example",
+			status: http.StatusNoContent, allowOrigin: "*"},
+		{name: "preflight not listed", origins: []string{"https://a.example"}, method: http.MethodOptions, origin: "https://b.example",
+			status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := CORS(tt.origins)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			r := httptest.NewRequest(tt.method, "/api/v1/ups", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.allowOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != tt.credentials {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, tt.credentials)
+			}
+		})
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     []string
+		method      string
+		origin      string
+		fetchSite   string
+		contentType string
+		status      int
+	}{
+		{name: "same origin", method: http.MethodPost, origin: "http://example.com", fetchSite: "same-origin", status: http.StatusOK},
+		{name: "no headers", method: http.MethodPost, status: http.StatusOK},
+		{name: "other origin", method: http.MethodPost, origin: "https://evil.example", fetchSite: "cross-site", status: http.StatusForbidden},
+		{name: "null origin", method: http.MethodPost, origin: "null", status: http.StatusForbidden},
+		{name: "cross-site without origin", method: http.MethodPost, fetchSite: "cross-site", status: http.StatusForbidden},
+		{name: "listed origin", origins: []string{"https://a.example/"}, method: http.MethodPost, origin: "https://a.example",
+			fetchSite: "cross-site", status: http.StatusOK},
+		{name: "any origin", origins: []string{"*"}, method: http.MethodPost, origin: "https://b.example", status: http.StatusOK},
+		{name: "form", method: http.MethodPost, contentType: "application/x-www-form-urlencoded", status: http.StatusUnsupportedMediaType},
+		{name: "plain text", method: http.MethodPost, origin: "http://example.com", contentType: "text/plain", status: http.StatusUnsupportedMediaType},
+		{name: "read", method: http.MethodGet, origin: "https://evil.example", fetchSite: "cross-site", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := SameOrigin(tt.origins)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			r := httptest.NewRequest(tt.method, "/api/v1/ups/abc/commands/load.off", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.fetchSite != "" {
+				r.Header.Set("Sec-Fetch-Site", tt.fetchSite)
+			}
+			r.Header.Set("Content-Type", "application/json")
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// operation - an endpoint of the API in the OpenAPI description. The schemas of the responses are generated
+// from the types the handlers encode, so the description follows the implementation.
+type operation struct {
+	Method      string
+	Path        string
+	Summary     string
+	Params      []parameter
+	Body        map[string]any
+	Response    map[string]any
+	ContentType string
+	Errors      []int
+}
+
+// parameter - a path or query parameter of the operation
+type parameter struct {
+	Name        string
+	In          string
+	Description string
+	Required    bool
+	Schema      map[string]any
+}
+
+var (
+	stringSchema  = map[string]any{"type": "string"}
+	integerSchema = map[string]any{"type": "integer"}
+	errorSchema   = object(map[string]any{"error": stringSchema}, "error")
+	okSchema      = object(map[string]any{"status": map[string]any{"type": "string", "enum": []string{"ok"}}}, "status")
+	upsIDParam    = parameter{Name: "id", In: "path", Description: "id of the UPS or name of the group", Required: true, Schema: stringSchema}
+)
+
+// operations returns the endpoints of the API served by the router
+func (s *Rest) operations() []operation {
+	list := []operation{
+		{Method: "GET", Path: "/api/v1/version", Summary: "Application version, commit, build date and Go version", Response: schemaFor[versionJSON]()},
+		{Method: "GET", Path: "/api/v1/clients", Summary: "Clients connected to each UPS", Response: schemaFor[[]clientsJSON]()},
+		{Method: "GET", Path: "/api/v1/ups/{id}", Summary: "Details of the UPS with all variables", Params: []parameter{upsIDParam}, Response: schemaFor[upsJSON](), Errors: []int{http.StatusNotFound}},
+		{
+			Method:  "GET",
+			Path:    "/api/v1/ups/{id}/status",
+			Summary: "Status of the UPS, a single line like `OL 100 up` with ?format=text",
+			Params: []parameter{upsIDParam, {
+				Name: "format", In: "query", Description: "text for a single line", Schema: map[string]any{"type": "string", "enum": []string{"text"}},
+			}},
+			Response: schemaFor[statusJSON](),
+			Errors:   []int{http.StatusNotFound},
+		},
+		{Method: "POST", Path: "/api/v1/ups/{id}/refresh", Summary: "Poll the UPS immediately and return its status", Params: []parameter{upsIDParam}, Response: schemaFor[statusJSON](), Errors: []int{http.StatusNotFound}},
+		{Method: "GET", Path: "/api/v1/ups/{id}/export", Summary: "Everything known about the UPS as a JSON document to download", Params: []parameter{upsIDParam}, Response: schemaFor[exportJSON](), Errors: []int{http.StatusNotFound}},
+		{Method: "GET", Path: "/api/v1/ups/{id}/power", Summary: "Shutdown and startup delays, running timers and load commands of the UPS", Params: []parameter{upsIDParam}, Response: schemaFor[powerJSON](), Errors: []int{http.StatusNotFound}},
+		{Method: "POST", Path: "/api/v1/ups/{id}/extremes/reset", Summary: "Clear the extremes of the UPS, requires ALLOW_WRITE", Params: []parameter{upsIDParam}, Response: okSchema, Errors: []int{http.StatusForbidden, http.StatusNotFound}},
+		{
+			Method:  "GET",
+			Path:    "/api/v1/check",
+			Summary: "Nagios/Icinga compatible check, the state is in the X-Nagios-Status and X-Nagios-Exit-Code headers",
+			Params: []parameter{
+				{Name: "ups", In: "query", Description: "id of the UPS or name of the group", Required: true, Schema: stringSchema},
+				{Name: "warn", In: "query", Description: "battery charge (%) at or below which the state is WARNING", Schema: integerSchema},
+				{Name: "crit", In: "query", Description: "battery charge (%) at or below which the state is CRITICAL", Schema: integerSchema},
+			},
+			Response:    stringSchema,
+			ContentType: "text/plain",
+		},
+		{Method: "GET", Path: "/api/v1/summary", Summary: "Overview of all NUT servers and UPSs", Response: schemaFor[summaryJSON]()},
+		{
+			Method:  "POST",
+			Path:    "/api/v1/ups/{id}/variables/{name}",
+			Summary: "Set the writeable variable, requires ALLOW_WRITE. The value is read back unless ?confirm=false",
+			Params: []parameter{upsIDParam,
+				{Name: "name", In: "path", Description: "name of the variable", Required: true, Schema: stringSchema},
+				{Name: "confirm", In: "query", Description: "false skips the read back", Schema: map[string]any{"type": "boolean"}},
+			},
+			Body: object(map[string]any{"value": stringSchema}, "value"),
+			Response: object(map[string]any{
+				"status":    stringSchema,
+				"requested": stringSchema,
+				"value":     stringSchema,
+				"warning":   stringSchema,
+			}, "status", "requested"),
+			Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusUnsupportedMediaType, http.StatusBadGateway},
+		},
+		{
+			Method:  "POST",
+			Path:    "/api/v1/ups/{id}/commands/{name}",
+			Summary: "Run the instant command, requires ALLOW_WRITE",
+			Params: []parameter{upsIDParam,
+				{Name: "name", In: "path", Description: "name of the command, e.g. beeper.mute", Required: true, Schema: stringSchema},
+			},
+			Response: okSchema,
+			Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusUnsupportedMediaType, http.StatusBadGateway},
+		},
+	}
+	if s.DependencyMap {
+		list = append(list, operation{Method: "GET", Path: "/api/v1/dependencies", Summary: "Client hosts with the UPSs each of them depends on", Response: schemaFor[dependencyMap]()})
+	}
+	if !s.SeparateMetrics {
+		list = append(list, operation{Method: "GET", Path: "/metrics", Summary: "Metrics in the Prometheus format", Response: stringSchema, ContentType: "text/plain"})
+	}
+	return append(list, operation{Method: "GET", Path: "/api/v1/openapi.json", Summary: "This description of the API", Response: map[string]any{"type": "object"}})
+}
+
+// openapi returns the OpenAPI 3 description of the API
+func (s *Rest) openapi(w http.ResponseWriter, r *http.Request) {
+	paths := map[string]map[string]any{}
+	for _, op := range s.operations() {
+		contentType := op.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		responses := map[string]any{
+			"200": map[string]any{
+				"description": "OK",
+				"content":     map[string]any{contentType: map[string]any{"schema": op.Response}},
+			},
+		}
+		for _, code := range op.Errors {
+			responses[strconv.Itoa(code)] = map[string]any{
+				"description": http.StatusText(code),
+				"content":     map[string]any{"application/json": map[string]any{"schema": errorSchema}},
+			}
+		}
+
+		o := map[string]any{"summary": op.Summary, "responses": responses}
+		var params []map[string]any
+		for _, p := range op.Params {
+			params = append(params, map[string]any{
+				"name":        p.Name,
+				"in":          p.In,
+				"description": p.Description,
+				"required":    p.Required,
+				"schema":      p.Schema,
+			})
+		}
+		if params != nil {
+			o["parameters"] = params
+		}
+		if op.Body != nil {
+			o["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": op.Body},
+				},
+			}
+		}
+
+		if paths[op.Path] == nil {
+			paths[op.Path] = map[string]any{}
+		}
+		paths[op.Path][strings.ToLower(op.Method)] = o
+	}
+
+	s.json(w, map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "NutShell API",
+			"version": s.Version,
+		},
+		"paths": paths,
+	})
+}
+
+// object returns the schema of an object with the properties
+func object(properties map[string]any, required ...string) map[string]any {
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func schemaFor[T any]() map[string]any {
+	return schema(reflect.TypeFor[T]())
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// schema returns the JSON schema of the values of the type as encoded by encoding/json: the fields without
+// omitempty are required, pointers are nullable and interfaces are any value
+func schema(t reflect.Type) map[string]any {
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := schema(t.Elem())
+		s["nullable"] = true
+		return s
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": schema(t.Elem())}
+	case reflect.Array:
+		return map[string]any{"type": "array", "items": schema(t.Elem()), "minItems": t.Len(), "maxItems": t.Len()}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schema(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]any{}
+		var required []string
+		for i := range t.NumField() {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" && options == "" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = schema(field.Type)
+			if !strings.Contains(options, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		return object(properties, required...)
+	}
+	// any value
+	return map[string]any{}
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOperationsDescribeRoutes(t *testing.T) {
+	tests := []struct {
+		name string
+		rest *Rest
+	}{
+		{name: "default", rest: &Rest{}},
+		{name: "dependency map", rest: &Rest{DependencyMap: true}},
+		{name: "separate metrics", rest: &Rest{SeparateMetrics: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var described []string
+			for _, op := range tt.rest.operations() {
+				described = append(described, op.Method+" "+op.Path)
+			}
+			var served []string
+			for _, pattern := range tt.rest.routes().patterns {
+				method, path, _ := strings.Cut(pattern, " ")
+				if !strings.HasPrefix(path, "/api/v1/") && path != "/metrics" {
+					continue
+				}
+				served = append(served, pattern)
+				if !slices.Contains(described, method+" "+path) {
+					t.Errorf("route %s is missing in operations", pattern)
+				}
+			}
+			for _, op := range described {
+				if !slices.Contains(served, op) {
+					t.Errorf("operation %s is not served by the router", op)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// powerDelay - the ups.delay.* variable tuning the shutdown and the startup of the UPS
+type powerDelay struct {
+	Name      string `json:"name"`
+	Title     string `json:"title"`
+	Value     int64  `json:"value"`
+	Writeable bool   `json:"writeable"`
+}
+
+// powerTimer - the ups.timer.* countdown of the shutdown or the startup in progress
+type powerTimer struct {
+	Name    string `json:"name"`
+	Title   string `json:"title"`
+	Value   int64  `json:"value"`
+	Running bool   `json:"running"`
+}
+
+// powerCommand - the instant command switching the load of the UPS, Warning is asked before running it
+type powerCommand struct {
+	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Warning     string `json:"warning,omitempty"`
+	Allowed     bool   `json:"allowed"`
+}
+
+// powerJSON - the shutdown and startup tuning of the UPS, see GET /api/v1/ups/{id}/power
+type powerJSON struct {
+	Delays   []powerDelay   `json:"delays"`
+	Timers   []powerTimer   `json:"timers"`
+	Commands []powerCommand `json:"commands"`
+}
+
+// powerTitles are the titles of the well-known delays and timers, the others are titled by the name
+var powerTitles = map[string]string{
+	"ups.delay.shutdown": "Shutdown delay",
+	"ups.delay.start":    "Start delay",
+	"ups.delay.reboot":   "Reboot delay",
+	"ups.timer.shutdown": "Shutdown in",
+	"ups.timer.start":    "Start in",
+	"ups.timer.reboot":   "Reboot in",
+}
+
+// powerCommands are the load commands of the panel in the order shown
+var powerCommands = []string{"shutdown.return", "shutdown.stayoff", "load.off", "load.on"}
+
+// power returns the delays, the running timers and the load commands of the UPS. The commands are allowed
+// with AllowWrite and AllowCommands, the delays are writeable with AllowWrite when the driver allows it.
+func (s *Rest) power(ups UPS) powerJSON {
+	p := powerJSON{Delays: []powerDelay{}, Timers: []powerTimer{}, Commands: []powerCommand{}}
+	for _, v := range ups.CurrentVariables() {
+		value, ok := ups.IntVar(v.Name)
+		if !ok {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(v.Name, "ups.delay."):
+			p.Delays = append(p.Delays, powerDelay{
+				Name:      v.Name,
+				Title:     powerTitle(v.Name),
+				Value:     value,
+				Writeable: s.AllowWrite && v.Writeable,
+			})
+		case strings.HasPrefix(v.Name, "ups.timer."):
+			// drivers report -1 or 0 when the countdown isn't running
+			p.Timers = append(p.Timers, powerTimer{Name: v.Name, Title: powerTitle(v.Name), Value: value, Running: value > 0})
+		}
+	}
+	slices.SortFunc(p.Delays, func(a, b powerDelay) int { return strings.Compare(a.Name, b.Name) })
+	slices.SortFunc(p.Timers, func(a, b powerTimer) int { return strings.Compare(a.Name, b.Name) })
+
+	shutdown := "the shutdown delay"
+	if delay, err := ups.GetShutdownDelay(); err == nil {
+		shutdown = fmt.Sprintf("the shutdown delay of %ds", delay)
+	}
+	start := "the start delay"
+	if delay, err := ups.GetStartDelay(); err == nil {
+		start = fmt.Sprintf("the start delay of %ds", delay)
+	}
+	for _, name := range powerCommands {
+		if !ups.HasCommand(name) {
+			continue
+		}
+		cmd := powerCommand{Name: name, Allowed: s.AllowWrite && s.commandAllowed(name)}
+		switch name {
+		case "shutdown.return":
+			cmd.Title = "Shutdown and return"
+			cmd.Description = fmt.Sprintf("Turns off the load after %s and turns it on again when the line power returns, after %s", shutdown, start)
+			cmd.Warning = fmt.Sprintf("Everything connected to %s loses power after %s, even when the line power is present, and gets it back only after a power loss. Continue?", ups.Device().Name, shutdown)
+		case "shutdown.stayoff":
+			cmd.Title = "Shutdown and stay off"
+			cmd.Description = fmt.Sprintf("Turns off the load after %s and keeps it off until turned on", shutdown)
+			cmd.Warning = fmt.Sprintf("Everything connected to %s loses power after %s and stays off until the load is turned on. Continue?", ups.Device().Name, shutdown)
+		case "load.off":
+			cmd.Title = "Load off"
+			cmd.Description = "Turns off the load immediately"
+			cmd.Warning = fmt.Sprintf("Everything connected to %s loses power immediately, without a delay for the clients to shut down. Continue?", ups.Device().Name)
+		case "load.on":
+			cmd.Title = "Load on"
+			cmd.Description = "Turns on the load"
+		}
+		p.Commands = append(p.Commands, cmd)
+	}
+	return p
+}
+
+// Shown reports whether the power panel has anything to show, the delays or the commands allowed to run
+func (p powerJSON) Shown() bool {
+	return len(p.Delays) > 0 || slices.ContainsFunc(p.Commands, func(c powerCommand) bool { return c.Allowed })
+}
+
+// powerTitle returns the title of the delay or the timer
+func powerTitle(name string) string {
+	if title, ok := powerTitles[name]; ok {
+		return title
+	}
+	return name
+}
+
+// powerState returns the shutdown and startup tuning of the UPS
+func (s *Rest) powerState(w http.ResponseWriter, r *http.Request) {
+	ups := s.findUPS(r.PathValue("id"))
+	if ups == nil {
+		s.jsonError(w, http.StatusNotFound, "UPS not found")
+		return
+	}
+	s.json(w, s.power(ups))
+}
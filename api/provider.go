@@ -0,0 +1,124 @@
+package api
+
+import (
+	"nutshell/pkg/nut"
+	"time"
+)
+
+// Provider - a source of UPSs served by the API, e.g. a NUT server. The handlers only use the UPSs through it,
+// NUTProvider adapts *nut.Client, other sources and tests can return UPSs built from their variables.
+type Provider interface {
+	// Name returns the display name of the source
+	Name() string
+	// Address returns the host:port of the source
+	Address() string
+	// ServerVersion returns the version of the server and of its protocol, empty when not known
+	ServerVersion() (string, string)
+	// UPSs returns all UPSs of the source, an error when there are none
+	UPSs() ([]UPS, error)
+	// UPS returns the UPS with the id
+	UPS(id string) (UPS, error)
+	// Pending returns the names of the UPSs known to the source and not ready yet
+	Pending() []string
+	// Stats returns the commands and the bytes exchanged with the source
+	Stats() nut.Stats
+	// AuthError returns the error of the credentials rejected by the source, nil otherwise
+	AuthError() error
+}
+
+// UPS - a UPS served by the API, the handlers read and control it only through these methods.
+// *nut.UPS is the implementation of the NUT servers, see the methods there for the details.
+type UPS interface {
+	Device() nut.Device
+	ServerName() string
+	SupportedCommands() []nut.Command
+	HasCommand(name string) bool
+
+	// state of the polling
+	Refresh()
+	PollIfOlder(maxAge time.Duration) bool
+	Updated() time.Time
+	Healthy() bool
+	Expired() bool
+	Restored() bool
+	Reconnecting() bool
+	Failures() nut.PollFailures
+	SlowResponses() bool
+	GetPollLatency() nut.PollLatency
+	AuthError() error
+
+	// variables read by the last poll
+	CurrentVariables() []nut.Variable
+	LastVariables() []nut.Variable
+	StringVar(name string) (string, bool)
+	IntVar(name string) (int64, bool)
+	FloatVar(name string) (float64, bool)
+	IsWriteable(name string) bool
+	GetVariableEnums(name string) ([]string, error)
+	GetVariableRanges(name string) ([][2]float64, error)
+	ConnectedClients() []string
+	NumLogins() (int64, bool)
+	GetRole() string
+
+	// values derived from the variables
+	GetStatus() (string, string, error)
+	DebouncedStatus() string
+	GetAlarm() (string, bool)
+	StuckBattery() (time.Time, bool)
+	StuckBatteryMessage() string
+	GetBattery() (int64, int64, float64, error)
+	GetBatteryVoltage() nut.BatteryVoltage
+	GetChargerStatus() (string, bool)
+	GetRuntime() (int64, error)
+	GetRuntimeToLowBattery() (int64, error)
+	GetLoad() (int64, int64, error)
+	GetCurrent() (float64, error)
+	GetApparentPower() (float64, error)
+	GetPowerFactor() (float64, error)
+	GetEfficiency() (float64, error)
+	GetEnergy() (nut.Energy, bool)
+	GetExtremes() nut.Extremes
+	ResetExtremes()
+	GetBeeper() (string, error)
+	GetTestResult() (string, error)
+	GetShutdownDelay() (int64, error)
+	GetStartDelay() (int64, error)
+	GetOutlets() []nut.Outlet
+	GetDriver() nut.Driver
+
+	// control of the UPS
+	SendCommand(name string) (bool, error)
+	SetVariable(name, value string, confirm bool) (nut.SetResult, error)
+}
+
+// NUTProvider returns the provider of the UPSs of the NUT server
+func NUTProvider(client *nut.Client) Provider {
+	return nutProvider{Client: client}
+}
+
+// nutProvider - *nut.Client serving its UPSs as UPS
+type nutProvider struct {
+	*nut.Client
+}
+
+func (p nutProvider) UPSs() ([]UPS, error) {
+	list, err := p.Client.UPSs()
+	if err != nil {
+		return nil, err
+	}
+	upss := make([]UPS, 0, len(list))
+	for _, u := range list {
+		upss = append(upss, u)
+	}
+	return upss, nil
+}
+
+func (p nutProvider) UPS(id string) (UPS, error) {
+	u, err := p.Client.UPS(id)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+var _ UPS = (*nut.UPS)(nil)
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"fmt"
+	"nutshell/pkg/nut"
+)
+
+// fakeProvider - the provider of the tests serving UPSs built from their variables, without a server
+type fakeProvider struct {
+	name string
+	upss []UPS
+}
+
+func (p *fakeProvider) Name() string                    { return p.name }
+func (p *fakeProvider) Address() string                 { return p.name }
+func (p *fakeProvider) ServerVersion() (string, string) { return "", "" }
+func (p *fakeProvider) Pending() []string               { return nil }
+func (p *fakeProvider) Stats() nut.Stats                { return nut.Stats{} }
+func (p *fakeProvider) AuthError() error                { return nil }
+
+func (p *fakeProvider) UPSs() ([]UPS, error) {
+	if len(p.upss) == 0 {
+		return nil, fmt.Errorf("no UPSs found")
+	}
+	return p.upss, nil
+}
+
+func (p *fakeProvider) UPS(id string) (UPS, error) {
+	for _, u := range p.upss {
+		if u.Device().ID == id {
+			return u, nil
+		}
+	}
+	return nil, fmt.Errorf("UPS %s not found", id)
+}
+
+// fakeUPS returns the UPS with the variables, the values are parsed like the ones read from the server
+func fakeUPS(id, name, server string, vars map[string]string) *nut.UPS {
+	u := &nut.UPS{ID: id, Name: name, Server: server}
+	for k, v := range vars {
+		u.Variables = append(u.Variables, nut.Variable{Name: k, Value: v, Raw: v, Type: "STRING"})
+	}
+	return u
+}
@@ -1,110 +1,331 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
 	"log"
 	"net/http"
 	"nutshell/pkg"
 	"nutshell/pkg/nut"
+	"path"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 type Rest struct {
-	Version  string
-	Template *pkg.Template
-	Clients  []*nut.Client
+	Version   string
+	Commit    string
+	BuildDate string
+	Template  *pkg.Template
+	Providers []Provider
+
+	BatteryWarning  int64
+	BatteryCritical int64
+
+	Labels map[string]Label
+	Groups map[string][]string
+
+	AllowWrite bool
+	// AllowCommands limits the instant commands run and advertised, patterns like outlet.*.load.on, all when empty
+	AllowCommands []string
+	SimpleUI      bool
+	// StripPrefixes groups the variables table by namespace and shows the names without it
+	StripPrefixes bool
+	CORSOrigins   []string
+	CSP           string
+	// Precision is the number of decimals of fractional values in the API, e.g. voltage
+	Precision int
+
+	// StatusSeverity overrides the severity (ok, warning or critical) of the status flags shown as badges,
+	// e.g. TRIM: warning
+	StatusSeverity map[string]string
+
+	// MetricsVariables are the names or patterns of the numeric variables exported as nut_ups_variable
+	// in addition to the curated series, none by default to keep the cardinality low
+	MetricsVariables []string
+
+	// MergeDuplicates shows the UPSs reported by several connections with the same vendor, model and serial
+	// number as a single entry of the healthiest one, they are detected and logged regardless
+	MergeDuplicates bool
+
+	// DependencyMap serves the map of the client hosts and the UPSs they depend on, built from LIST CLIENT
+	DependencyMap bool
+
+	// SeparateMetrics moves /metrics from the main router to the MetricsRouter
+	SeparateMetrics bool
+
+	// Middlewares wrap the handlers of the Router in order after the default chain, e.g. an authentication
+	// of an embedding program. The request id is already assigned, see RequestIDFrom.
+	Middlewares []Middleware
+
+	warnedDuplicates sync.Map
+}
+
+// Label - display metadata of the UPS from the configuration, the key is the UPS id or name
+type Label struct {
+	Label    string
+	Location string
+	Order    int
+	Primary  bool
 }
 
 func (s *Rest) Router() *http.ServeMux {
-	router := NewRouter(Recoverer, CORS, Healthz, Info("NutGUI", s.Version))
+	return s.routes().mux
+}
+
+// routes registers the pages and the API, every /api/v1 route must be described in operations
+func (s *Rest) routes() *Router {
+	// the request id is assigned first, so every log line of the request has it
+	router := NewRouter(RequestID, AccessLog, Recoverer, SecurityHeaders(s.contentSecurityPolicy, s.CSP == ""), CORS(s.CORSOrigins), SameOrigin(s.CORSOrigins), Healthz, Info("NutGUI", s.Version))
+	router.Use(s.Middlewares...)
 
 	router.HandleFunc("GET /", s.list)
 	router.HandleFunc("GET /{id}", s.details)
+	router.HandleFunc("GET /compare", s.compare)
 	router.HandleFunc("GET /static/", s.static)
+	router.HandleFunc("GET /favicon.svg", s.favicon)
+
+	router.HandleFunc("GET /api/v1/version", s.version)
+	router.HandleFunc("GET /api/v1/openapi.json", s.openapi)
+	router.HandleFunc("GET /api/v1/clients", s.clients)
+	router.HandleFunc("GET /api/v1/ups/{id}", s.ups)
+	router.HandleFunc("GET /api/v1/ups/{id}/status", s.status)
+	router.HandleFunc("POST /api/v1/ups/{id}/refresh", s.refresh)
+	router.HandleFunc("GET /api/v1/ups/{id}/export", s.export)
+	router.HandleFunc("POST /api/v1/ups/{id}/extremes/reset", s.resetExtremes)
+	router.HandleFunc("GET /api/v1/ups/{id}/power", s.powerState)
+	router.HandleFunc("GET /api/v1/check", s.check)
+	router.HandleFunc("GET /api/v1/summary", s.summary)
+	router.HandleFunc("POST /api/v1/ups/{id}/variables/{name}", s.setVariable)
+	router.HandleFunc("POST /api/v1/ups/{id}/commands/{name}", s.runCommand)
+
+	if s.DependencyMap {
+		router.HandleFunc("GET /dependencies", s.dependenciesPage)
+		router.HandleFunc("GET /api/v1/dependencies", s.dependencies)
+	}
+
+	if !s.SeparateMetrics {
+		router.HandleFunc("GET /metrics", s.metrics)
+	}
 
+	// preflight requests are answered by the CORS middleware
+	router.HandleFunc("OPTIONS /", http.NotFound)
+
+	return router
+}
+
+// MetricsRouter returns the router serving only /metrics, for a listener separate from the UI and API
+func (s *Rest) MetricsRouter() *http.ServeMux {
+	router := NewRouter(RequestID, AccessLog, Recoverer)
+	router.HandleFunc("GET /metrics", s.metrics)
 	return router.mux
 }
 
+// contentSecurityPolicy returns the configured policy, or the default one allowing only own resources
+// and the inline scripts of the templates
+func (s *Rest) contentSecurityPolicy() string {
+	if s.CSP != "" {
+		return s.CSP
+	}
+	scripts := strings.Join(append([]string{"'self'"}, s.Template.ScriptHashes...), " ")
+	return "default-src 'self'; script-src " + scripts + "; style-src 'self' 'unsafe-inline'; img-src 'self' data:; " +
+		"object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'self'"
+}
+
 func (s *Rest) notFound(w http.ResponseWriter, r *http.Request) {
+	if s.unavailable(w, s.Template.NotFound) {
+		return
+	}
 	if err := s.Template.NotFound.Execute(w, nil); err != nil {
-		log.Printf("[ERROR] generate not found html: %v", err)
+		log.Printf("[ERROR] generate not found html: %v (request %s)", err, requestID(r))
 		http.Error(w, fmt.Sprintf("error generate not found html: %v", err), http.StatusInternalServerError)
 	}
 }
 
-func (s *Rest) list(w http.ResponseWriter, r *http.Request) {
-	type ups struct {
-		ID             string
-		Name           string
-		Status         string
-		OriginalStatus string
-		Battery        int64
-		Load           int64
-		Power          int64
-		Runtime        string
-	}
-
-	var list []ups
-	var totalLoad int64 = 0
-	for _, client := range s.Clients {
-		if client == nil {
+// unavailable responds with 503 when the template is not loaded, the error of the
+// templates load is included in the debug mode
+func (s *Rest) unavailable(w http.ResponseWriter, t *template.Template) bool {
+	if t != nil {
+		return false
+	}
+
+	msg := http.StatusText(http.StatusServiceUnavailable)
+	if s.Template.Debug && s.Template.Err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, s.Template.Err)
+	}
+	w.Header().Set("Retry-After", "10")
+	http.Error(w, msg, http.StatusServiceUnavailable)
+	return true
+}
+
+// row - UPS shown in the list, the summary of its state
+type row struct {
+	ID             string  `json:"id"`
+	Name           string  `json:"name"`
+	Label          string  `json:"label"`
+	Location       string  `json:"location,omitempty"`
+	Order          int     `json:"order"`
+	Primary        bool    `json:"primary"`
+	Server         string  `json:"server"`
+	Duplicate      bool    `json:"-"`
+	Status         string  `json:"description"`
+	OriginalStatus string  `json:"status"`
+	Badges         []badge `json:"-"`
+	State          string  `json:"state"`
+	Alarm          string  `json:"alarm,omitempty"`
+	Role           string  `json:"role"`
+	Battery        int64   `json:"battery"`
+	BatteryLevel   string  `json:"battery_level"`
+	Load           int64   `json:"load"`
+	Power          int64   `json:"power"`
+	Runtime        string  `json:"runtime"`
+	Degraded       bool    `json:"degraded"`
+	Slow           bool    `json:"slow_responses"`
+	Restored       bool    `json:"restored"`
+	ConfigError    string  `json:"config_error,omitempty"`
+	// Merged are the sources of the same UPS merged into the row with MergeDuplicates, as name@host:port
+	Merged []string `json:"merged,omitempty"`
+}
+
+// pendingRow - a UPS listed by the server and not read yet, shown as loading
+type pendingRow struct {
+	Name   string `json:"name"`
+	Server string `json:"server"`
+}
+
+// pending returns the UPSs of all providers not read yet
+func (s *Rest) pending() []pendingRow {
+	var list []pendingRow
+	for _, provider := range s.Providers {
+		if provider == nil {
+			continue
+		}
+		for _, name := range provider.Pending() {
+			list = append(list, pendingRow{Name: name, Server: provider.Name()})
+		}
+	}
+	return list
+}
+
+// rows gathers the state of all UPSs and groups, sorted for display
+func (s *Rest) rows() []row {
+	entries := s.entries()
+	var merged map[string][]string
+	if s.MergeDuplicates {
+		entries, merged = s.mergeDuplicates(entries, s.duplicates(entries))
+	}
+
+	var list []row
+	for _, e := range entries {
+		u := e.UPS
+		status, originalStatus, err := u.GetStatus()
+		if err != nil {
+			log.Printf("[ERROR] get status for %s: %v", u.Device().Name, err)
 			continue
 		}
-		upss, err := client.UPSs()
+		battery, low, _, err := u.GetBattery()
 		if err != nil {
-			log.Printf("[ERROR] get UPSs for %s: %v", client.Hostname, err)
+			log.Printf("[ERROR] get battery for %s: %v", u.Device().Name, err)
 			continue
 		}
-		if len(upss) == 0 {
+		load, power, err := u.GetLoad()
+		if err != nil {
+			log.Printf("[ERROR] get load for %s: %v", u.Device().Name, err)
 			continue
 		}
-		for _, u := range upss {
-			status, originalStatus, err := u.GetStatus()
-			if err != nil {
-				log.Printf("[ERROR] get status for %s: %v", u.Name, err)
-				continue
-			}
-			battery, _, _, err := u.GetBattery()
-			if err != nil {
-				log.Printf("[ERROR] get battery for %s: %v", u.Name, err)
-				continue
-			}
-			load, power, err := u.GetLoad()
-			if err != nil {
-				log.Printf("[ERROR] get load for %s: %v", u.Name, err)
-				continue
-			}
-			runtime, err := u.GetRuntime()
-			if err != nil {
-				log.Printf("[ERROR] get runtime for %s: %v", u.Name, err)
-				continue
-			}
-			formattedRuntime := time.Duration(runtime) * time.Second
+		// an expired UPS is listed without values
+		runtime, err := u.GetRuntime()
+		if err != nil && !u.Expired() {
+			log.Printf("[ERROR] get runtime for %s: %v", u.Device().Name, err)
+			continue
+		}
+		formattedRuntime := (time.Duration(runtime) * time.Second).String()
+		if u.Expired() {
+			formattedRuntime = ""
+		}
+		alarm, _ := u.GetAlarm()
+		var configError string
+		if err := u.AuthError(); err != nil {
+			configError = err.Error()
+		}
+
+		list = append(list, row{
+			ID:             e.ID,
+			Name:           u.Device().Name,
+			Label:          e.Label.Label,
+			Location:       e.Label.Location,
+			Order:          e.Label.Order,
+			Primary:        e.Label.Primary,
+			Server:         u.ServerName(),
+			Status:         status,
+			OriginalStatus: originalStatus,
+			Badges:         s.badges(u, originalStatus),
+			State:          state(u.DebouncedStatus()),
+			Alarm:          alarm,
+			Role:           u.GetRole(),
+			Battery:        battery,
+			BatteryLevel:   s.batteryLevel(battery, low),
+			Load:           load,
+			Power:          power,
+			Runtime:        formattedRuntime,
+			Degraded:       u.Reconnecting() || u.Restored(),
+			Slow:           u.SlowResponses(),
+			Restored:       u.Restored(),
+			ConfigError:    configError,
+			Merged:         merged[e.ID],
+		})
+	}
+
+	// the server is shown only for UPSs with the same name on different servers
+	names := make(map[string]int)
+	for _, u := range list {
+		names[u.Label]++
+	}
+	for i := range list {
+		list[i].Duplicate = names[list[i].Label] > 1
+	}
 
-			list = append(list, ups{
-				ID:             u.ID,
-				Name:           u.Name,
-				Status:         status,
-				OriginalStatus: originalStatus,
-				Battery:        battery,
-				Load:           load,
-				Power:          power,
-				Runtime:        formattedRuntime.String(),
-			})
-			totalLoad += power
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Primary != list[j].Primary {
+			return list[i].Primary
+		}
+		if list[i].Order != list[j].Order {
+			return list[i].Order < list[j].Order
+		}
+		if list[i].Label != list[j].Label {
+			return list[i].Label < list[j].Label
+		}
+		return list[i].Server < list[j].Server
+	})
+
+	return list
+}
+
+// overall combines the states of UPSs: up, down, degraded when some are down, or unknown.
+// The primary UPS on battery makes the overall state down regardless of the others.
+func overall(list []row) string {
+	for _, u := range list {
+		if u.Primary && u.State == "down" {
+			return "down"
 		}
 	}
 
 	status := "unknown"
 	for _, u := range list {
-		if strings.Contains(u.OriginalStatus, "OL") {
+		switch u.State {
+		case "up":
 			if status == "unknown" {
 				status = "up"
 			} else if status == "down" {
 				status = "degraded"
 			}
-		} else if strings.Contains(u.OriginalStatus, "OB") {
+		case "down":
 			if status == "unknown" {
 				status = "down"
 			} else if status == "up" {
@@ -112,106 +333,937 @@ func (s *Rest) list(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	}
+	return status
+}
+
+// totalLoad sums the power of UPSs in watts
+func totalLoad(list []row) int64 {
+	var total int64
+	for _, u := range list {
+		total += u.Power
+	}
+	return total
+}
+
+func (s *Rest) list(w http.ResponseWriter, r *http.Request) {
+	list := s.rows()
 
 	data := struct {
-		List      []ups
+		List      []row
+		Loading   []pendingRow
 		Status    string
 		TotalLoad int64
+		Primary   *row
+		Global    string
+		Alert     string
+		// Duplicates are the UPSs reported by several connections, Merged when shown as a single entry
+		Duplicates []duplicateSet
+		Merged     bool
 	}{
-		List:      list,
-		Status:    status,
-		TotalLoad: totalLoad,
+		List:       list,
+		Loading:    s.pending(),
+		Status:     overall(list),
+		TotalLoad:  totalLoad(list),
+		Duplicates: s.duplicates(s.entries()),
+		Merged:     s.MergeDuplicates,
+	}
+	data.Global, data.Alert = data.Status, alert(data.Status)
+	for i := range list {
+		if list[i].Primary {
+			data.Primary = &list[i]
+			break
+		}
 	}
 
+	if s.unavailable(w, s.Template.List) {
+		return
+	}
 	if err := s.Template.List.Execute(w, data); err != nil {
-		log.Printf("[ERROR] generate list html: %v", err)
+		log.Printf("[ERROR] generate list html: %v (request %s)", err, requestID(r))
 		http.Error(w, fmt.Sprintf("error generate list html: %v", err), http.StatusInternalServerError)
 	}
 }
 
 func (s *Rest) details(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-
-	var ups *nut.UPS
-	for _, c := range s.Clients {
-		if u, err := c.UPS(id); err == nil && u != nil {
-			ups = u
-			break
-		}
-	}
+	ups := s.findUPS(r.PathValue("id"))
 	if ups == nil {
 		s.notFound(w, r)
 		return
 	}
 
 	type loadT struct {
-		Value int64
-		Power int64
+		Value      int64
+		Power      int64
+		Efficiency float64
+		Energy     string
+		Since      string
+		Measured   bool
+		// the electrical values formatted with the unit, empty when not reported by the UPS
+		Current     string
+		Apparent    string
+		PowerFactor string
 	}
 	type batteryT struct {
-		Charge  int64
-		Low     int64
-		Voltage float64
+		Charge     int64
+		Low        int64
+		Voltage    float64
+		RawVoltage float64
+		Adjusted   bool
+		Level      string
+		// Charger is the description of battery.charger.status, empty when not reported
+		Charger string
 	}
 	type statusT struct {
 		Value    string
 		Original string
-		Runtime  string
+		Badges   []badge
+		Runtime  int64
+		Alarmed  bool
+		Alarm    string
+		Stuck    string
+	}
+	type beeperT struct {
+		Status  string
+		Actions []action
+	}
+	type testT struct {
+		Result  string
+		Actions []action
+	}
+	type outletT struct {
+		Title   string
+		Status  string
+		Power   int64
+		Current float64
+		Actions []action
+	}
+	// seconds, nil when not known
+	type powerLossT struct {
+		LowBattery    *int64
+		ShutdownDelay *int64
+		Runtime       *int64
+	}
+	type pollT struct {
+		Degraded    bool
+		Restored    bool
+		Expired     bool
+		Age         string
+		Slow        string
+		ConfigError string
+		Failed      bool
+		Consecutive int64
+		Total       int64
+		Error       string
+		Ago         string
 	}
 
 	status, originalStatus, _ := ups.GetStatus()
 	battery, low, voltage, _ := ups.GetBattery()
+	batteryVoltage := ups.GetBatteryVoltage()
 	load, power, _ := ups.GetLoad()
 	runtime, _ := ups.GetRuntime()
-	formattedRuntime := time.Duration(runtime) * time.Second
+	alarm, alarmed := ups.GetAlarm()
+
+	efficiency, _ := ups.GetEfficiency()
+	loadInfo := loadT{Value: load, Power: power, Efficiency: efficiency}
+	if energy, ok := ups.GetEnergy(); ok {
+		loadInfo.Energy = formatEnergy(energy.KWh)
+		loadInfo.Since = energy.Since.Format(time.DateTime)
+		loadInfo.Measured = energy.Measured
+	}
+	if value, err := ups.GetCurrent(); err == nil {
+		loadInfo.Current = fmt.Sprintf("%.1f A", value)
+	}
+	if value, err := ups.GetApparentPower(); err == nil {
+		loadInfo.Apparent = fmt.Sprintf("%.0f VA", value)
+	}
+	if value, err := ups.GetPowerFactor(); err == nil {
+		loadInfo.PowerFactor = fmt.Sprintf("%.2f", value)
+	}
 
+	// what happens on power loss: the clients shut down at the low battery, then the UPS cuts the power after the delay
+	var powerLoss powerLossT
+	if seconds, err := ups.GetRuntimeToLowBattery(); err == nil {
+		powerLoss.LowBattery = &seconds
+	}
+	if delay, err := ups.GetShutdownDelay(); err == nil {
+		powerLoss.ShutdownDelay = &delay
+	}
+	if runtime > 0 {
+		powerLoss.Runtime = &runtime
+	}
+
+	beeperStatus, _ := ups.GetBeeper()
+	beeper := beeperT{
+		Status:  beeperStatus,
+		Actions: s.beeperActions(ups, beeperStatus),
+	}
+
+	testResult, _ := ups.GetTestResult()
+	test := testT{Result: testResult}
+	if s.AllowWrite {
+		for _, a := range []action{
+			{Title: "Quick test", Command: "test.battery.start.quick"},
+			{Title: "Deep test", Command: "test.battery.start.deep"},
+			{Title: "Stop test", Command: "test.battery.stop"},
+		} {
+			if s.hasCommand(ups, a.Command) {
+				test.Actions = append(test.Actions, a)
+			}
+		}
+	}
+
+	var outlets []outletT
+	for _, o := range ups.GetOutlets() {
+		title := o.Description
+		if title == "" {
+			title = o.Prefix
+		}
+		outlets = append(outlets, outletT{
+			Title:   title,
+			Status:  o.Status,
+			Power:   o.Power,
+			Current: o.Current,
+			Actions: s.outletActions(ups, o),
+		})
+	}
+
+	var charger string
+	if state, ok := ups.GetChargerStatus(); ok {
+		charger = nut.ChargerDescription(state)
+	}
+
+	failures := ups.Failures()
+	poll := pollT{
+		Degraded:    ups.Reconnecting(),
+		Restored:    ups.Restored(),
+		Expired:     ups.Expired(),
+		Age:         snapshotAge(ups),
+		Failed:      failures.Consecutive > 0,
+		Consecutive: failures.Consecutive,
+		Total:       failures.Total,
+		Error:       failures.LastError,
+	}
+	if !failures.LastFailure.IsZero() {
+		poll.Ago = time.Since(failures.LastFailure).Truncate(time.Second).String()
+	}
+	if latency := ups.GetPollLatency(); ups.SlowResponses() {
+		poll.Slow = fmt.Sprintf("95%% of the recent polls took up to %s, over %s", latency.P95.Round(time.Millisecond), latency.Threshold)
+	}
+	if err := ups.AuthError(); err != nil {
+		poll.ConfigError = err.Error()
+	}
+
+	label := s.label(ups)
+	if _, ok := s.Groups[r.PathValue("id")]; ok {
+		label = s.groupLabel(r.PathValue("id"))
+	}
+	device := ups.Device()
 	data := struct {
 		ID           string
 		Name         string
+		Label        string
+		Location     string
 		Description  string
 		Manufacturer string
 		Model        string
 		Server       string
 		Online       bool
 
-		Load    loadT
-		Battery batteryT
-		Status  statusT
+		Load      loadT
+		Battery   batteryT
+		Status    statusT
+		Power     powerJSON
+		Beeper    beeperT
+		Test      testT
+		Outlets   []outletT
+		Poll      pollT
+		Driver    nut.Driver
+		PowerLoss powerLossT
+		Role      string
+		Extremes  []extremeRow
+		Reset     bool
+
+		Variables []variableGroup
+		Clients   []string
+		// Logins is the number of clients logged in to the UPS, empty when not known
+		Logins string
+		Expert bool
 
-		Variables []nut.Variable
+		Global string
+		Alert  string
 	}{
-		ID:           ups.ID,
-		Name:         ups.Name,
-		Description:  ups.Description,
-		Manufacturer: ups.Manufacturer,
-		Model:        ups.Model,
-		Server:       ups.Server,
-		Online:       strings.Contains(originalStatus, "OL"),
-
-		Load: loadT{
-			Value: load,
-			Power: power,
-		},
+		ID:           r.PathValue("id"),
+		Name:         device.Name,
+		Label:        label.Label,
+		Location:     label.Location,
+		Description:  device.Description,
+		Manufacturer: device.Manufacturer,
+		Model:        device.Model,
+		Server:       ups.ServerName(),
+		Online:       strings.Contains(ups.DebouncedStatus(), "OL"),
+
+		Load: loadInfo,
 		Battery: batteryT{
-			Charge:  battery,
-			Low:     low,
-			Voltage: voltage,
+			Charge:     battery,
+			Low:        low,
+			Voltage:    voltage,
+			RawVoltage: batteryVoltage.Raw,
+			Adjusted:   batteryVoltage.Scale != 1,
+			Level:      s.batteryLevel(battery, low),
+			Charger:    charger,
 		},
 		Status: statusT{
 			Value:    status,
 			Original: originalStatus,
-			Runtime:  formattedRuntime.String(),
+			Badges:   s.badges(ups, originalStatus),
+			Runtime:  runtime,
+			Alarmed:  alarmed,
+			Alarm:    alarm,
 		},
+		Power:     s.power(ups),
+		Beeper:    beeper,
+		Test:      test,
+		Outlets:   outlets,
+		Poll:      poll,
+		Driver:    ups.GetDriver(),
+		PowerLoss: powerLoss,
+		Role:      ups.GetRole(),
+		Extremes:  extremeRows(ups.GetExtremes()),
+		Reset:     s.AllowWrite,
 
-		Variables: ups.Variables,
+		Variables: s.variableGroups(ups.CurrentVariables()),
+		Clients:   ups.ConnectedClients(),
+		Expert:    !s.SimpleUI || r.URL.Query().Get("expert") == "1",
 	}
+	if _, stuck := ups.StuckBattery(); stuck {
+		data.Status.Stuck = ups.StuckBatteryMessage()
+	}
+	if logins, ok := ups.NumLogins(); ok {
+		data.Logins = strconv.FormatInt(logins, 10)
+	}
+	data.Global = overall(s.rows())
+	data.Alert = alert(data.Global)
 
+	if s.unavailable(w, s.Template.Details) {
+		return
+	}
 	if err := s.Template.Details.Execute(w, data); err != nil {
-		log.Printf("[ERROR] generate details html: %v", err)
+		log.Printf("[ERROR] generate details html: %v (request %s)", err, requestID(r))
 		http.Error(w, fmt.Sprintf("error generate details html: %v", err), http.StatusInternalServerError)
 	}
 }
 
+// formatEnergy formats the energy in kWh, small amounts in Wh
+func formatEnergy(kWh float64) string {
+	if kWh < 1 {
+		return fmt.Sprintf("%.0f Wh", kWh*1000)
+	}
+	return fmt.Sprintf("%.2f kWh", kWh)
+}
+
+// variableGroup - variables of a namespace in the variables table, e.g. battery
+type variableGroup struct {
+	Namespace string
+	Variables []variableRow
+}
+
+// variableRow - variable in the variables table, Name is the displayed name and FullName the variable name
+type variableRow struct {
+	Name        string
+	FullName    string
+	Description string
+	Value       any
+}
+
+// variableGroups groups the variables by namespace and strips it from the names with StripPrefixes,
+// otherwise all variables are in a single group without namespace
+func (s *Rest) variableGroups(variables []nut.Variable) []variableGroup {
+	if !s.StripPrefixes {
+		group := variableGroup{}
+		for _, v := range variables {
+			group.Variables = append(group.Variables, variableRow{Name: v.Name, FullName: v.Name, Description: v.Description, Value: v.Value})
+		}
+		return []variableGroup{group}
+	}
+
+	var groups []variableGroup
+	index := make(map[string]int)
+	for _, v := range variables {
+		namespace, name, ok := strings.Cut(v.Name, ".")
+		if !ok {
+			namespace, name = "", v.Name
+		}
+		i, ok := index[namespace]
+		if !ok {
+			i = len(groups)
+			index[namespace] = i
+			groups = append(groups, variableGroup{Namespace: namespace})
+		}
+		groups[i].Variables = append(groups[i].Variables, variableRow{Name: name, FullName: v.Name, Description: v.Description, Value: v.Value})
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].Namespace < groups[j].Namespace
+	})
+	return groups
+}
+
+// state returns up for the UPS on line power, down for the UPS on battery and unknown otherwise
+func state(status string) string {
+	if strings.Contains(status, "OL") {
+		return "up"
+	} else if strings.Contains(status, "OB") {
+		return "down"
+	}
+	return "unknown"
+}
+
+// action - UI control running the instant command or setting the variable to the value
+type action struct {
+	Title    string
+	Command  string
+	Variable string
+	Value    string
+	// Confirm is the question asked before the action, e.g. before cutting the power
+	Confirm string
+}
+
+// beeperActions returns the controls muting or enabling the beeper, using the instant commands
+// when supported and the ups.beeper.status variable otherwise
+func (s *Rest) beeperActions(ups UPS, status string) []action {
+	if !s.AllowWrite || status == "" {
+		return nil
+	}
+
+	if status == "enabled" {
+		for _, cmd := range []string{"beeper.mute", "beeper.disable"} {
+			if s.hasCommand(ups, cmd) {
+				return []action{{Title: "Mute", Command: cmd}}
+			}
+		}
+		if ups.IsWriteable("ups.beeper.status") {
+			return []action{{Title: "Mute", Variable: "ups.beeper.status", Value: "disabled"}}
+		}
+		return nil
+	}
+
+	if s.hasCommand(ups, "beeper.enable") {
+		return []action{{Title: "Enable", Command: "beeper.enable"}}
+	}
+	if ups.IsWriteable("ups.beeper.status") {
+		return []action{{Title: "Enable", Variable: "ups.beeper.status", Value: "enabled"}}
+	}
+	return nil
+}
+
+// outletActions returns the action switching the outlet to the opposite state, when the outlet is switchable
+// and the UPS supports the command
+func (s *Rest) outletActions(ups UPS, outlet nut.Outlet) []action {
+	if !s.AllowWrite || !outlet.Switchable {
+		return nil
+	}
+
+	a := action{Title: "Switch off", Command: outlet.Prefix + ".load.off", Confirm: "Cut the power of the outlet?"}
+	if outlet.Status == "off" {
+		a = action{Title: "Switch on", Command: outlet.Prefix + ".load.on"}
+	}
+	if !s.hasCommand(ups, a.Command) {
+		return nil
+	}
+	return []action{a}
+}
+
+// hasCommand reports whether the UPS supports the instant command and it's allowed by AllowCommands
+func (s *Rest) hasCommand(ups UPS, name string) bool {
+	return ups.HasCommand(name) && s.commandAllowed(name)
+}
+
+// commandAllowed reports whether the instant command matches AllowCommands, any command is allowed when it's empty
+func (s *Rest) commandAllowed(name string) bool {
+	if len(s.AllowCommands) == 0 {
+		return true
+	}
+	for _, pattern := range s.AllowCommands {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// findUPS returns the UPS with the id from any of the providers, or the best member of the group
+// with the name, nil if not found
+func (s *Rest) findUPS(id string) UPS {
+	if _, ok := s.Groups[id]; ok {
+		return s.resolveGroup(id)
+	}
+	for _, p := range s.Providers {
+		if u, err := p.UPS(id); err == nil && u != nil {
+			u.Refresh()
+			return u
+		}
+	}
+	return nil
+}
+
+// upss returns the UPSs of the provider, refreshed on request when the background polling is disabled
+func (s *Rest) upss(provider Provider) ([]UPS, error) {
+	list, err := provider.UPSs()
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range list {
+		u.Refresh()
+	}
+	return list, nil
+}
+
+// snapshotAge returns the time since the last successful read of the UPS variables
+func snapshotAge(u UPS) string {
+	if u.Updated().IsZero() {
+		return ""
+	}
+	return time.Since(u.Updated()).Truncate(time.Second).String()
+}
+
+// label returns the configured display metadata of the UPS looked up by id and then by name.
+// The label falls back to the UPS name when not configured.
+func (s *Rest) label(u UPS) Label {
+	device := u.Device()
+	label, ok := s.Labels[device.ID]
+	if !ok {
+		label = s.Labels[device.Name]
+	}
+	if label.Label == "" {
+		label.Label = device.Name
+	}
+	return label
+}
+
+// batteryLevel returns the severity of the battery charge: ok, warning or critical.
+// The device low battery setpoint is treated as critical when it is higher than the configured one.
+func (s *Rest) batteryLevel(charge, low int64) string {
+	critical := s.BatteryCritical
+	if low > critical {
+		critical = low
+	}
+	switch {
+	case charge <= critical:
+		return "critical"
+	case charge <= s.BatteryWarning:
+		return "warning"
+	default:
+		return "ok"
+	}
+}
+
+// runCommand sends the instant command to the UPS and refreshes its variables to reflect the result
+func (s *Rest) runCommand(w http.ResponseWriter, r *http.Request) {
+	if !s.AllowWrite {
+		s.jsonError(w, http.StatusForbidden, "running commands is disabled")
+		return
+	}
+	ups := s.findUPS(r.PathValue("id"))
+	if ups == nil {
+		s.jsonError(w, http.StatusNotFound, "UPS not found")
+		return
+	}
+
+	name := r.PathValue("name")
+	if !s.commandAllowed(name) {
+		s.jsonError(w, http.StatusForbidden, fmt.Sprintf("command %s is not allowed", name))
+		return
+	}
+	if !ups.HasCommand(name) {
+		s.jsonError(w, http.StatusBadRequest, fmt.Sprintf("command %s is not supported by the UPS", name))
+		return
+	}
+	if _, err := ups.SendCommand(name); err != nil {
+		log.Printf("[ERROR] run %s on %s: %v (request %s)", name, ups.Device().Name, err, requestID(r))
+		s.jsonError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	log.Printf("[INFO] %s sent to %s (request %s)", name, ups.Device().Name, requestID(r))
+
+	// polled out of band, serialized with the background polling
+	ups.PollIfOlder(0)
+
+	s.json(w, map[string]string{"status": "ok"})
+}
+
+// statusJSON - the short status of the UPS, see GET /api/v1/ups/{id}/status
+type statusJSON struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+	Description string `json:"description"`
+	Debounced   string `json:"debounced_status"`
+	Charger     string `json:"charger_status,omitempty"`
+	State       string `json:"state"`
+	Alarmed     bool   `json:"alarmed"`
+	Alarm       string `json:"alarm,omitempty"`
+	Stuck       bool   `json:"stuck_battery"`
+	Battery     int64  `json:"battery"`
+	Voltage     struct {
+		Value   float64 `json:"value"`
+		Raw     float64 `json:"raw"`
+		Nominal float64 `json:"nominal,omitempty"`
+	} `json:"battery_voltage"`
+	Degraded    bool   `json:"degraded"`
+	Restored    bool   `json:"restored"`
+	Expired     bool   `json:"expired"`
+	SnapshotAge string `json:"snapshot_age,omitempty"`
+	Slow        bool   `json:"slow_responses"`
+	Poll        struct {
+		ConsecutiveFailures int64      `json:"consecutive_failures"`
+		TotalFailures       int64      `json:"total_failures"`
+		LastError           string     `json:"last_error,omitempty"`
+		LastFailure         *time.Time `json:"last_failure,omitempty"`
+		Latency             struct {
+			P50       string `json:"p50"`
+			P95       string `json:"p95"`
+			Max       string `json:"max"`
+			Samples   int    `json:"samples"`
+			Threshold string `json:"threshold,omitempty"`
+		} `json:"latency"`
+	} `json:"poll"`
+}
+
+// status returns the short status of the UPS as JSON, or as a single line with ?format=text
+func (s *Rest) status(w http.ResponseWriter, r *http.Request) {
+	ups := s.findUPS(r.PathValue("id"))
+	if ups == nil {
+		s.jsonError(w, http.StatusNotFound, "UPS not found")
+		return
+	}
+
+	status, originalStatus, _ := ups.GetStatus()
+	battery, _, _, _ := ups.GetBattery()
+
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = fmt.Fprintf(w, "%s %d %s\n", originalStatus, battery, state(ups.DebouncedStatus()))
+		return
+	}
+
+	device := ups.Device()
+	resp := statusJSON{
+		ID:          device.ID,
+		Name:        device.Name,
+		Status:      originalStatus,
+		Description: status,
+		Debounced:   ups.DebouncedStatus(),
+		State:       state(ups.DebouncedStatus()),
+		Battery:     battery,
+		Degraded:    ups.Reconnecting() || ups.Restored(),
+		Restored:    ups.Restored(),
+		Expired:     ups.Expired(),
+	}
+	if resp.Degraded {
+		resp.SnapshotAge = snapshotAge(ups)
+	}
+	resp.Alarm, resp.Alarmed = ups.GetAlarm()
+	resp.Charger, _ = ups.GetChargerStatus()
+	_, resp.Stuck = ups.StuckBattery()
+	voltage := ups.GetBatteryVoltage()
+	resp.Voltage.Value, resp.Voltage.Raw, resp.Voltage.Nominal = voltage.Value, voltage.Raw, voltage.Nominal
+	failures := ups.Failures()
+	resp.Poll.ConsecutiveFailures = failures.Consecutive
+	resp.Poll.TotalFailures = failures.Total
+	resp.Poll.LastError = failures.LastError
+	if !failures.LastFailure.IsZero() {
+		resp.Poll.LastFailure = &failures.LastFailure
+	}
+	latency := ups.GetPollLatency()
+	resp.Slow = ups.SlowResponses()
+	resp.Poll.Latency.P50 = latency.P50.Round(time.Millisecond).String()
+	resp.Poll.Latency.P95 = latency.P95.Round(time.Millisecond).String()
+	resp.Poll.Latency.Max = latency.Max.Round(time.Millisecond).String()
+	resp.Poll.Latency.Samples = latency.Samples
+	if latency.Threshold > 0 {
+		resp.Poll.Latency.Threshold = latency.Threshold.String()
+	}
+
+	s.json(w, resp)
+}
+
+// quantity - a value in the documented unit
+type quantity struct {
+	Value any    `json:"value"`
+	Unit  string `json:"unit"`
+}
+
+// energyJSON - the energy used by the load since the start
+type energyJSON struct {
+	Value    any       `json:"value"`
+	Unit     string    `json:"unit"`
+	Since    time.Time `json:"since"`
+	Measured bool      `json:"measured"`
+}
+
+// driverJSON - the driver of the UPS and its state
+type driverJSON struct {
+	Name            string            `json:"name"`
+	Version         string            `json:"version"`
+	VersionInternal string            `json:"version_internal,omitempty"`
+	State           string            `json:"state,omitempty"`
+	Healthy         bool              `json:"healthy"`
+	Parameters      map[string]string `json:"parameters"`
+}
+
+// upsJSON - the details of the UPS, see GET /api/v1/ups/{id}
+type upsJSON struct {
+	ID             string       `json:"id"`
+	Name           string       `json:"name"`
+	Label          string       `json:"label"`
+	Server         string       `json:"server"`
+	Status         string       `json:"status"`
+	Description    string       `json:"description"`
+	State          string       `json:"state"`
+	BatteryCharge  quantity     `json:"battery_charge"`
+	BatteryVoltage quantity     `json:"battery_voltage"`
+	Runtime        quantity     `json:"runtime"`
+	Load           quantity     `json:"load"`
+	Power          quantity     `json:"power"`
+	Current        *quantity    `json:"current,omitempty"`
+	ApparentPower  *quantity    `json:"apparent_power,omitempty"`
+	PowerFactor    *float64     `json:"power_factor,omitempty"`
+	Role           string       `json:"role"`
+	Driver         driverJSON   `json:"driver"`
+	Efficiency     *quantity    `json:"efficiency,omitempty"`
+	Energy         *energyJSON  `json:"energy,omitempty"`
+	Extremes       extremesJSON `json:"extremes"`
+	Variables      []normalized `json:"variables"`
+}
+
+// ups returns the details of the UPS, numeric values are in the documented units and precision
+func (s *Rest) ups(w http.ResponseWriter, r *http.Request) {
+	ups := s.findUPS(r.PathValue("id"))
+	if ups == nil {
+		s.jsonError(w, http.StatusNotFound, "UPS not found")
+		return
+	}
+
+	status, originalStatus, _ := ups.GetStatus()
+	charge, _, _, _ := ups.GetBattery()
+	load, power, _ := ups.GetLoad()
+	runtime, _ := ups.GetRuntime()
+	voltage := ups.GetBatteryVoltage()
+	driver := ups.GetDriver()
+	label := s.label(ups)
+
+	// the efficiency reported by the device, and the energy estimated by nutshell from the power
+	var efficiency *quantity
+	if value, err := ups.GetEfficiency(); err == nil {
+		efficiency = &quantity{Value: round(value, s.Precision), Unit: "%"}
+	}
+	var energy *energyJSON
+	if value, ok := ups.GetEnergy(); ok {
+		energy = &energyJSON{Value: round(value.KWh, 3), Unit: "kWh", Since: value.Since, Measured: value.Measured}
+	}
+
+	// the electrical values reported by the device, omitted when not reported
+	var current, apparent *quantity
+	var powerFactor *float64
+	if value, err := ups.GetCurrent(); err == nil {
+		current = &quantity{Value: round(value, s.Precision), Unit: "A"}
+	}
+	if value, err := ups.GetApparentPower(); err == nil {
+		apparent = &quantity{Value: round(value, 0), Unit: "VA"}
+	}
+	if value, err := ups.GetPowerFactor(); err == nil {
+		value = round(value, 2)
+		powerFactor = &value
+	}
+
+	list := ups.CurrentVariables()
+	variables := make([]normalized, 0, len(list))
+	for _, v := range list {
+		variables = append(variables, s.normalize(v))
+	}
+
+	device := ups.Device()
+	s.json(w, upsJSON{
+		ID:             device.ID,
+		Name:           device.Name,
+		Label:          label.Label,
+		Server:         ups.ServerName(),
+		Status:         originalStatus,
+		Description:    status,
+		State:          state(ups.DebouncedStatus()),
+		BatteryCharge:  quantity{Value: charge, Unit: "%"},
+		BatteryVoltage: quantity{Value: round(voltage.Value, s.Precision), Unit: "V"},
+		Runtime:        quantity{Value: runtime, Unit: "s"},
+		Load:           quantity{Value: load, Unit: "%"},
+		Power:          quantity{Value: power, Unit: "W"},
+		Current:        current,
+		ApparentPower:  apparent,
+		PowerFactor:    powerFactor,
+		Role:           ups.GetRole(),
+		Driver: driverJSON{
+			Name:            driver.Name,
+			Version:         driver.Version,
+			VersionInternal: driver.VersionInternal,
+			State:           driver.State,
+			Healthy:         driver.Healthy(),
+			Parameters:      driver.Parameters,
+		},
+		Efficiency: efficiency,
+		Energy:     energy,
+		Extremes:   s.extremesJSON(ups.GetExtremes()),
+		Variables:  variables,
+	})
+}
+
+// minRefreshInterval limits the forced polls of a UPS, a poll younger than that is returned as is
+const minRefreshInterval = 2 * time.Second
+
+// refresh polls the UPS immediately and returns its fresh status
+func (s *Rest) refresh(w http.ResponseWriter, r *http.Request) {
+	ups := s.findUPS(r.PathValue("id"))
+	if ups == nil {
+		s.jsonError(w, http.StatusNotFound, "UPS not found")
+		return
+	}
+	if ups.PollIfOlder(minRefreshInterval) {
+		log.Printf("[DEBUG] %s polled on request (request %s)", ups.Device().Name, requestID(r))
+	}
+	s.status(w, r)
+}
+
+// setVariable sets the value of the writeable UPS variable, the value is read from the form or JSON body
+func (s *Rest) setVariable(w http.ResponseWriter, r *http.Request) {
+	if !s.AllowWrite {
+		s.jsonError(w, http.StatusForbidden, "changing variables is disabled")
+		return
+	}
+	ups := s.findUPS(r.PathValue("id"))
+	if ups == nil {
+		s.jsonError(w, http.StatusNotFound, "UPS not found")
+		return
+	}
+
+	// only JSON is accepted by SameOrigin, a form can be posted by any other site without a preflight request
+	var body struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		s.jsonError(w, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	name, value := r.PathValue("name"), body.Value
+
+	// the value is read back unless confirm=false, the driver may clamp or ignore it
+	confirm := r.URL.Query().Get("confirm") != "false"
+	result, err := ups.SetVariable(name, value, confirm)
+	var validationErr *nut.ValidationError
+	if errors.As(err, &validationErr) {
+		s.jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] set %s of %s: %v (request %s)", name, ups.Device().Name, err, requestID(r))
+		s.jsonError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	log.Printf("[INFO] %s of %s set to %q (request %s)", name, ups.Device().Name, value, requestID(r))
+	// the page and the power panel show the cached variables, a changed delay also changes the warnings.
+	// Polled out of band, serialized with the background polling.
+	ups.PollIfOlder(0)
+
+	resp := map[string]string{"status": "ok", "requested": result.Requested}
+	if result.Confirmed {
+		resp["value"] = result.Actual
+	}
+	if !result.Applied() {
+		// the driver applies some values asynchronously, the difference may also be a value not applied yet
+		resp["warning"] = fmt.Sprintf("%s is %q instead of %q, the driver may have clamped or ignored the value, or not applied it yet",
+			name, result.Actual, result.Requested)
+		log.Printf("[WARN] %s: %s (request %s)", ups.Device().Name, resp["warning"], requestID(r))
+	}
+	s.json(w, resp)
+}
+
+// versionJSON - the version and build information, see GET /api/v1/version
+type versionJSON struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	Date    string `json:"date"`
+	Go      string `json:"go"`
+}
+
+// version returns the version and build information of the application
+func (s *Rest) version(w http.ResponseWriter, r *http.Request) {
+	s.json(w, versionJSON{
+		Version: s.Version,
+		Commit:  s.Commit,
+		Date:    s.BuildDate,
+		Go:      runtime.Version(),
+	})
+}
+
+// clientsJSON - the clients connected to the UPS
+type clientsJSON struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Label    string   `json:"label"`
+	Location string   `json:"location,omitempty"`
+	Server   string   `json:"server"`
+	Clients  []string `json:"clients"`
+	Logins   *int64   `json:"logins,omitempty"`
+}
+
+// clients returns the list of clients connected to each UPS
+func (s *Rest) clients(w http.ResponseWriter, r *http.Request) {
+	list := []clientsJSON{}
+	for _, provider := range s.Providers {
+		if provider == nil {
+			continue
+		}
+		upss, err := s.upss(provider)
+		if err != nil {
+			continue
+		}
+		for _, u := range upss {
+			clients := u.ConnectedClients()
+			if clients == nil {
+				clients = []string{}
+			}
+			label := s.label(u)
+			device := u.Device()
+			entry := clientsJSON{
+				ID:       device.ID,
+				Name:     device.Name,
+				Label:    label.Label,
+				Location: label.Location,
+				Server:   u.ServerName(),
+				Clients:  clients,
+			}
+			if logins, ok := u.NumLogins(); ok {
+				entry.Logins = &logins
+			}
+			list = append(list, entry)
+		}
+	}
+
+	s.json(w, list)
+}
+
+func (s *Rest) jsonError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(map[string]string{"error": msg}); err != nil {
+		log.Printf("[ERROR] encode json: %v", err)
+	}
+}
+
+func (s *Rest) json(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("[ERROR] encode json: %v", err)
+	}
+}
+
 func (s *Rest) static(w http.ResponseWriter, r *http.Request) {
 	path := fmt.Sprintf("template%s", r.URL.Path)
 	if _, err := s.Template.FS.Open(path); err != nil {
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"nutshell/pkg"
+	"nutshell/pkg/nut"
+	"strings"
+	"testing"
+)
+
+func TestOutletActions(t *testing.T) {
+	ups := &nut.UPS{Name: "ups", Commands: []nut.Command{{Name: "outlet.1.load.off"}, {Name: "outlet.1.load.on"}}}
+	tests := []struct {
+		name       string
+		allowWrite bool
+		outlet     nut.Outlet
+		want       string
+	}{
+		{name: "switch off", allowWrite: true, outlet: nut.Outlet{Prefix: "outlet.1", Status: "on", Switchable: true}, want: "outlet.1.load.off"},
+		{name: "switch on", allowWrite: true, outlet: nut.Outlet{Prefix: "outlet.1", Status: "off", Switchable: true}, want: "outlet.1.load.on"},
+		{name: "not switchable", allowWrite: true, outlet: nut.Outlet{Prefix: "outlet.1", Status: "on"}},
+		{name: "read only", outlet: nut.Outlet{Prefix: "outlet.1", Status: "on", Switchable: true}},
+		{name: "no command", allowWrite: true, outlet: nut.Outlet{Prefix: "outlet.2", Status: "on", Switchable: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Rest{AllowWrite: tt.allowWrite}
+			actions := s.outletActions(ups, tt.outlet)
+			if tt.want == "" {
+				if len(actions) != 0 {
+					t.Errorf("actions = %+v, want none", actions)
+				}
+				return
+			}
+			if len(actions) != 1 || actions[0].Command != tt.want {
+				t.Errorf("actions = %+v, want %s", actions, tt.want)
+			}
+		})
+	}
+}
+
+func TestCrossSiteCommand(t *testing.T) {
+	ups := fakeUPS("abc", "ups", "nut", map[string]string{"ups.status": "OL"})
+	ups.Commands = []nut.Command{{Name: "load.off"}}
+	s := &Rest{Template: &pkg.Template{}, Providers: []Provider{&fakeProvider{name: "nut", upss: []UPS{ups}}}, AllowWrite: true}
+	tests := []struct {
+		name      string
+		origin    string
+		fetchSite string
+		status    int
+	}{
+		{name: "other site", origin: "https://evil.example", fetchSite: "cross-site", status: http.StatusForbidden},
+		// browsers sending neither Origin nor Sec-Fetch-Site still can't send JSON without a preflight request
+		{name: "old browser", status: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/ups/abc/commands/load.off", nil)
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+				r.Header.Set("Sec-Fetch-Site", tt.fetchSite)
+			}
+			w := httptest.NewRecorder()
+			s.Router().ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
+
+func TestSetVariableRequiresJSON(t *testing.T) {
+	ups := fakeUPS("abc", "ups", "nut", map[string]string{"ups.status": "OL"})
+	s := &Rest{Template: &pkg.Template{}, Providers: []Provider{&fakeProvider{name: "nut", upss: []UPS{ups}}}, AllowWrite: true}
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{name: "form", contentType: "application/x-www-form-urlencoded", body: "value=1", status: http.StatusUnsupportedMediaType},
+		{name: "plain text", contentType: "text/plain", body: `{"value": "1"}`, status: http.StatusUnsupportedMediaType},
+		// the unknown variable is rejected by the validation, after the body was accepted
+		{name: "json", contentType: "application/json", body: `{"value": "1"}`, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/ups/abc/variables/ups.delay.shutdown", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			s.Router().ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
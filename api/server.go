@@ -5,7 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -14,6 +17,12 @@ import (
 type Server struct {
 	Address string
 	Port    int
+	Socket  string // unix socket path, replaces the TCP address when set
+
+	// TLSCert and TLSKey are the paths of the certificate and its key, the server serves HTTPS
+	// with HTTP/2 when set
+	TLSCert string
+	TLSKey  string
 
 	ReadHeaderTimeout time.Duration
 	WriteTimeout      time.Duration
@@ -42,12 +51,6 @@ func (s *Server) Run(router http.Handler) error {
 		s.IdleTimeout = 60 * time.Second
 	}
 
-	addr := s.Address
-	if addr == "" {
-		addr = "localhost"
-	}
-	log.Printf("[INFO] http rest server on http://%s:%d", addr, s.Port)
-
 	s.mu.Lock()
 	s.srv = &http.Server{
 		Addr:              fmt.Sprintf("%s:%d", s.Address, s.Port),
@@ -58,7 +61,17 @@ func (s *Server) Run(router http.Handler) error {
 	}
 	s.mu.Unlock()
 
-	if err := s.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	listener, err := s.listen()
+	if err != nil {
+		return fmt.Errorf("listen, %s", err)
+	}
+
+	if s.TLSCert != "" {
+		err = s.srv.ServeTLS(listener, s.TLSCert, s.TLSKey)
+	} else {
+		err = s.srv.Serve(listener)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("start http server, %s", err)
 	}
 
@@ -71,6 +84,10 @@ func (s *Server) Shutdown() error {
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	// Run didn't set up the server yet, there is nothing to shut down
+	if s.srv == nil {
+		return nil
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
@@ -79,5 +96,56 @@ func (s *Server) Shutdown() error {
 		return err
 	}
 
+	if s.Socket != "" {
+		if err := os.Remove(s.Socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove unix socket, %s", err)
+		}
+	}
+
 	return nil
 }
+
+// listen opens the unix socket when configured, otherwise the TCP address
+func (s *Server) listen() (net.Listener, error) {
+	if s.Socket == "" {
+		addr := s.Address
+		if addr == "" {
+			addr = "localhost"
+		}
+		scheme := "http"
+		if s.TLSCert != "" {
+			scheme = "https"
+		}
+		log.Printf("[INFO] http rest server on %s://%s:%d", scheme, addr, s.Port)
+		return net.Listen("tcp", s.srv.Addr)
+	}
+
+	// a socket left by a crashed instance blocks the listen, remove it unless someone still listens on it
+	if info, err := os.Stat(s.Socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", s.Socket); err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("unix socket %s is in use", s.Socket)
+		}
+		log.Printf("[DEBUG] remove stale unix socket %s", s.Socket)
+		if err := os.Remove(s.Socket); err != nil {
+			return nil, fmt.Errorf("remove stale unix socket, %s", err)
+		}
+	}
+
+	log.Printf("[INFO] http rest server on unix:%s", s.Socket)
+	return net.Listen("unix", s.Socket)
+}
+
+// RedirectHTTPS returns the handler redirecting all requests to the same host and path over HTTPS on the port
+func RedirectHTTPS(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
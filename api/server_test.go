@@ -0,0 +1,10 @@
+package api
+
+import "testing"
+
+func TestShutdownBeforeRun(t *testing.T) {
+	s := &Server{Port: 8080}
+	if err := s.Shutdown(); err != nil {
+		t.Errorf("Shutdown before Run: %v", err)
+	}
+}
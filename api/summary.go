@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+)
+
+// serverJSON - the NUT server in the summary
+type serverJSON struct {
+	Name            string `json:"name"`
+	Address         string `json:"address"`
+	Connected       bool   `json:"connected"`
+	Error           string `json:"error,omitempty"`
+	Version         string `json:"version"`
+	ProtocolVersion string `json:"protocol_version"`
+	UPSs            int    `json:"upss"`
+	Logins          int64  `json:"logins"`
+	Loading         int    `json:"loading"`
+	Traffic         struct {
+		Commands      int64 `json:"commands"`
+		Errors        int64 `json:"errors"`
+		BytesSent     int64 `json:"bytes_sent"`
+		BytesReceived int64 `json:"bytes_received"`
+	} `json:"traffic"`
+}
+
+// summaryJSON - the overview of all NUT servers and UPSs, see GET /api/v1/summary
+type summaryJSON struct {
+	Status    string         `json:"status"`
+	TotalLoad int64          `json:"total_load"`
+	Counts    map[string]int `json:"counts"`
+	Servers   []serverJSON   `json:"servers"`
+	UPSs      []row          `json:"upss"`
+	// Duplicates are the sources reporting the same UPS, see MergeDuplicates
+	Duplicates [][]string `json:"duplicates,omitempty"`
+}
+
+// summary returns the overview of all NUT servers and UPSs in a single payload,
+// everything a dashboard needs to render the whole fleet
+func (s *Rest) summary(w http.ResponseWriter, r *http.Request) {
+	servers := []serverJSON{}
+	for _, provider := range s.Providers {
+		if provider == nil {
+			continue
+		}
+		srv := serverJSON{
+			Name:    provider.Name(),
+			Address: provider.Address(),
+		}
+		srv.Version, srv.ProtocolVersion = provider.ServerVersion()
+		srv.Loading = len(provider.Pending())
+		if err := provider.AuthError(); err != nil {
+			srv.Error = err.Error()
+		}
+		stats := provider.Stats()
+		srv.Traffic.Commands, srv.Traffic.Errors = stats.Commands, stats.Errors
+		srv.Traffic.BytesSent, srv.Traffic.BytesReceived = stats.BytesSent, stats.BytesReceived
+		// the server is connected when any of its UPSs was polled successfully
+		if upss, err := s.upss(provider); err == nil {
+			srv.UPSs = len(upss)
+			for _, u := range upss {
+				if u.Healthy() {
+					srv.Connected = true
+				}
+				if logins, ok := u.NumLogins(); ok {
+					srv.Logins += logins
+				}
+			}
+		}
+		servers = append(servers, srv)
+	}
+
+	list := s.rows()
+	if list == nil {
+		list = []row{}
+	}
+	counts := map[string]int{"up": 0, "down": 0, "unknown": 0}
+	for _, u := range list {
+		counts[u.State]++
+	}
+
+	var duplicates [][]string
+	for _, set := range s.duplicates(s.entries()) {
+		duplicates = append(duplicates, set.Sources())
+	}
+
+	s.json(w, summaryJSON{
+		Status:     overall(list),
+		TotalLoad:  totalLoad(list),
+		Counts:     counts,
+		Servers:    servers,
+		UPSs:       list,
+		Duplicates: duplicates,
+	})
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"math"
+	"nutshell/pkg/nut"
+	"strings"
+)
+
+// unit - unit of the variables with the name suffix, integer values are rounded to whole numbers,
+// the others to the configured precision
+type unit struct {
+	suffix  string
+	unit    string
+	integer bool
+}
+
+// units of the variables by the name suffix
+var units = []unit{
+	{suffix: ".voltage.nominal", unit: "V"},
+	{suffix: ".voltage", unit: "V"},
+	{suffix: ".current", unit: "A"},
+	{suffix: ".frequency", unit: "Hz"},
+	{suffix: ".temperature", unit: "°C"},
+	{suffix: ".realpower.nominal", unit: "W", integer: true},
+	{suffix: ".realpower", unit: "W", integer: true},
+	{suffix: ".power.nominal", unit: "VA", integer: true},
+	{suffix: ".power", unit: "VA", integer: true},
+	{suffix: ".charge", unit: "%", integer: true},
+	{suffix: ".charge.low", unit: "%", integer: true},
+	{suffix: ".charge.warning", unit: "%", integer: true},
+	{suffix: ".load", unit: "%", integer: true},
+	{suffix: ".runtime", unit: "s", integer: true},
+	{suffix: ".runtime.low", unit: "s", integer: true},
+	{suffix: ".delay.shutdown", unit: "s", integer: true},
+	{suffix: ".delay.start", unit: "s", integer: true},
+	{suffix: ".delay.reboot", unit: "s", integer: true},
+}
+
+// normalized - variable value converted to the documented unit and precision, with the value reported by the server
+type normalized struct {
+	Name  string `json:"name"`
+	Value any    `json:"value"`
+	Unit  string `json:"unit,omitempty"`
+	Raw   string `json:"raw"`
+}
+
+// normalize rounds the numeric value of the variable with a known unit, other values are returned as is
+func (s *Rest) normalize(v nut.Variable) normalized {
+	n := normalized{Name: v.Name, Value: v.Value, Raw: v.Raw}
+	for _, u := range units {
+		if !strings.HasSuffix(v.Name, u.suffix) {
+			continue
+		}
+		var value float64
+		switch x := v.Value.(type) {
+		case int64:
+			value = float64(x)
+		case float64:
+			value = x
+		default:
+			return n
+		}
+		n.Unit = u.unit
+		if u.integer {
+			n.Value = int64(math.Round(value))
+		} else {
+			n.Value = round(value, s.Precision)
+		}
+		return n
+	}
+	return n
+}
+
+// round rounds the value to the number of decimals
+func round(value float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(value*p) / p
+}
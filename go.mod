@@ -1,9 +1,11 @@
 module nutshell
 
-go 1.24
+go 1.24.0
 
 require (
-	github.com/jessevdk/go-flags v1.6.1 // indirect
-	github.com/pkgz/logg v0.3.3 // indirect
-	golang.org/x/sys v0.21.0 // indirect
+	github.com/jessevdk/go-flags v1.6.1
+	github.com/pkgz/logg v0.3.3
+	golang.org/x/net v0.50.0
 )
+
+require golang.org/x/sys v0.41.0 // indirect
@@ -0,0 +1,485 @@
+// Package demo serves synthetic UPSs over the NUT protocol, so the UI can run without a NUT server and hardware.
+// The rack UPS goes through a simulated power outage every few minutes, the battery drains on battery
+// and charges back afterward, and the load of both UPSs fluctuates.
+package demo
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// cycle is the length of the simulated power event cycle, the UPS is on battery for the outage at its end
+	cycle  = 3 * time.Minute
+	outage = time.Minute
+	tick   = time.Second
+)
+
+// Server - NUT server with synthetic UPSs, listening on the loopback interface
+type Server struct {
+	listener net.Listener
+	mu       sync.Mutex
+	upss     []*ups
+	elapsed  time.Duration
+}
+
+// ups - synthetic UPS, the variables are kept in the order they were added
+type ups struct {
+	name        string
+	description string
+	vars        map[string]string
+	names       []string
+	writeable   map[string]string
+	enums       map[string][]string
+	commands    []string
+
+	nominal     float64
+	baseLoad    float64
+	fullRuntime float64
+	charge      float64
+	outages     bool
+}
+
+// Start starts the server on a random loopback port, it stops when the context is canceled
+func Start(ctx context.Context) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+	s := &Server{listener: listener, upss: []*ups{rack(), office()}}
+	for _, u := range s.upss {
+		s.update(u)
+	}
+
+	go s.animate(ctx)
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+	go s.accept()
+
+	log.Printf("[INFO] demo NUT server on %s", listener.Addr())
+	return s, nil
+}
+
+// Addr returns the host and the port of the server
+func (s *Server) Addr() (string, string) {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return host, port
+}
+
+func rack() *ups {
+	u := &ups{
+		name:        "rack",
+		description: "Demo rack UPS",
+		nominal:     1000,
+		baseLoad:    35,
+		fullRuntime: 2400,
+		charge:      100,
+		outages:     true,
+		writeable:   map[string]string{"ups.delay.shutdown": "RW NUMBER", "ups.delay.start": "RW NUMBER", "ups.beeper.status": "RW ENUM"},
+		enums:       map[string][]string{"ups.beeper.status": {"enabled", "disabled", "muted"}},
+		commands: []string{"beeper.enable", "beeper.disable", "beeper.mute", "test.battery.start.quick", "test.battery.start.deep",
+			"test.battery.stop", "outlet.1.load.off", "outlet.1.load.on", "outlet.2.load.off", "outlet.2.load.on"},
+	}
+	u.set("device.mfr", "APC")
+	u.set("device.model", "Smart-UPS 1500")
+	u.set("device.type", "ups")
+	u.set("driver.name", "usbhid-ups")
+	u.set("driver.version", "2.8.1")
+	u.set("driver.state", "quiet")
+	u.set("driver.parameter.port", "auto")
+	u.set("ups.mfr", "APC")
+	u.set("ups.model", "Smart-UPS 1500")
+	u.set("ups.serial", "AS1234567890")
+	u.set("ups.realpower.nominal", "1000")
+	u.set("ups.delay.shutdown", "20")
+	u.set("ups.delay.start", "30")
+	u.set("ups.beeper.status", "enabled")
+	u.set("ups.test.result", "Done and passed")
+	u.set("ups.efficiency", "95")
+	u.set("battery.charge.low", "10")
+	u.set("battery.runtime.low", "120")
+	u.set("battery.voltage.nominal", "24")
+	u.set("battery.type", "PbAc")
+	u.set("input.voltage.nominal", "230")
+	u.set("outlet.1.desc", "Servers")
+	u.set("outlet.1.status", "on")
+	u.set("outlet.2.desc", "Network")
+	u.set("outlet.2.status", "on")
+	return u
+}
+
+func office() *ups {
+	u := &ups{
+		name:        "office",
+		description: "Demo office UPS",
+		nominal:     360,
+		baseLoad:    20,
+		fullRuntime: 1500,
+		charge:      100,
+		writeable:   map[string]string{"ups.delay.shutdown": "RW NUMBER"},
+		commands:    []string{"test.battery.start.quick", "load.off"},
+	}
+	u.set("device.mfr", "Eaton")
+	u.set("device.model", "5E 650i")
+	u.set("driver.name", "usbhid-ups")
+	u.set("driver.version", "2.8.1")
+	u.set("ups.mfr", "Eaton")
+	u.set("ups.model", "5E 650i")
+	u.set("ups.realpower.nominal", "360")
+	u.set("ups.delay.shutdown", "20")
+	u.set("ups.test.result", "No test initiated")
+	u.set("battery.charge.low", "20")
+	u.set("battery.voltage.nominal", "12")
+	u.set("input.voltage.nominal", "230")
+	return u
+}
+
+// set sets the variable, new variables are added at the end
+func (u *ups) set(name, value string) {
+	if u.vars == nil {
+		u.vars = map[string]string{}
+	}
+	if _, ok := u.vars[name]; !ok {
+		u.names = append(u.names, name)
+	}
+	u.vars[name] = value
+}
+
+// animate advances the simulation by a tick until the context is canceled
+func (s *Server) animate(ctx context.Context) {
+	tk := time.NewTicker(tick)
+	defer tk.Stop()
+	for {
+		select {
+		case <-tk.C:
+			s.mu.Lock()
+			s.elapsed += tick
+			for _, u := range s.upss {
+				s.update(u)
+			}
+			s.mu.Unlock()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// update computes the variables of the UPS for the elapsed time, the caller must hold the lock
+func (s *Server) update(u *ups) {
+	t := s.elapsed.Seconds()
+	onBattery := u.outages && s.elapsed%cycle >= cycle-outage
+
+	// the load wanders around the base load
+	load := u.baseLoad + 8*math.Sin(t/23) + 3*math.Sin(t/7)
+	runtime := u.fullRuntime * u.charge / 100 * u.baseLoad / load
+
+	if onBattery {
+		// the full battery lasts fullRuntime at the base load
+		u.charge = math.Max(0, u.charge-100*tick.Seconds()/u.fullRuntime*load/u.baseLoad)
+	} else {
+		u.charge = math.Min(100, u.charge+0.5)
+	}
+
+	low, _ := strconv.ParseFloat(u.vars["battery.charge.low"], 64)
+	status := "OL"
+	switch {
+	case onBattery && u.charge <= low:
+		status = "OB DISCHRG LB"
+	case onBattery:
+		status = "OB DISCHRG"
+	case u.charge < 100:
+		status = "OL CHRG"
+	}
+
+	nominalVoltage, _ := strconv.ParseFloat(u.vars["battery.voltage.nominal"], 64)
+	inputVoltage := 230 + 2*math.Sin(t/11)
+	if onBattery {
+		inputVoltage = 0
+	}
+	u.set("ups.status", status)
+	u.set("ups.load", strconv.Itoa(int(math.Round(load))))
+	u.set("ups.realpower", strconv.Itoa(int(math.Round(load*u.nominal/100))))
+	u.set("ups.temperature", strconv.FormatFloat(math.Round((28+2*math.Sin(t/60))*10)/10, 'f', 1, 64))
+	u.set("battery.charge", strconv.Itoa(int(math.Round(u.charge))))
+	u.set("battery.runtime", strconv.Itoa(int(math.Round(runtime))))
+	u.set("battery.voltage", strconv.FormatFloat(math.Round(nominalVoltage*(0.9+0.2*u.charge/100)*10)/10, 'f', 1, 64))
+	u.set("input.voltage", strconv.FormatFloat(math.Round(inputVoltage*10)/10, 'f', 1, 64))
+	u.set("output.voltage", "230.0")
+	for _, outlet := range []string{"outlet.1", "outlet.2"} {
+		if u.vars[outlet+".status"] == "" {
+			continue
+		}
+		power := 0
+		if u.vars[outlet+".status"] == "on" {
+			power = int(math.Round(load * u.nominal / 100 / 2))
+		}
+		u.set(outlet+".realpower", strconv.Itoa(power))
+	}
+}
+
+func (s *Server) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.serve(conn)
+	}
+}
+
+// serve answers the commands of a connection until LOGOUT or the connection is closed
+func (s *Server) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		lines, done := s.handle(fields(scanner.Text()))
+		for _, line := range lines {
+			if _, err := fmt.Fprintf(conn, "%s\n", line); err != nil {
+				return
+			}
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// handle returns the response lines to the command, and whether the connection is closed after them
+func (s *Server) handle(args []string) ([]string, bool) {
+	if len(args) == 0 {
+		return []string{"ERR UNKNOWN-COMMAND"}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch args[0] {
+	case "USERNAME", "PASSWORD", "LOGIN":
+		return []string{"OK"}, false
+	case "LOGOUT":
+		return []string{"OK Goodbye"}, true
+	case "VER":
+		return []string{"Network UPS Tools upsd 2.8.1 - demo"}, false
+	case "NETVER":
+		return []string{"1.3"}, false
+	case "PRIMARY", "MASTER", "FSD":
+		return []string{"ERR ACCESS-DENIED"}, false
+	case "LIST":
+		return s.list(args[1:]), false
+	case "GET":
+		return s.get(args[1:]), false
+	case "SET":
+		return s.setVar(args[1:]), false
+	case "INSTCMD":
+		return s.instcmd(args[1:]), false
+	}
+	return []string{"ERR UNKNOWN-COMMAND"}, false
+}
+
+func (s *Server) byName(name string) *ups {
+	for _, u := range s.upss {
+		if u.name == name {
+			return u
+		}
+	}
+	return nil
+}
+
+func (s *Server) list(args []string) []string {
+	if len(args) == 1 && args[0] == "UPS" {
+		resp := []string{"BEGIN LIST UPS"}
+		for _, u := range s.upss {
+			resp = append(resp, fmt.Sprintf("UPS %s %s", u.name, quote(u.description)))
+		}
+		return append(resp, "END LIST UPS")
+	}
+	if len(args) < 2 {
+		return []string{"ERR INVALID-ARGUMENT"}
+	}
+	u := s.byName(args[1])
+	if u == nil {
+		return []string{"ERR UNKNOWN-UPS"}
+	}
+
+	header := strings.Join(args, " ")
+	resp := []string{"BEGIN LIST " + header}
+	switch args[0] {
+	case "VAR":
+		for _, name := range u.names {
+			resp = append(resp, fmt.Sprintf("VAR %s %s %s", u.name, name, quote(u.vars[name])))
+		}
+	case "CMD":
+		for _, cmd := range u.commands {
+			resp = append(resp, fmt.Sprintf("CMD %s %s", u.name, cmd))
+		}
+	case "CLIENT":
+		resp = append(resp, fmt.Sprintf("CLIENT %s 127.0.0.1", u.name))
+	case "ENUM":
+		if len(args) < 3 {
+			return []string{"ERR INVALID-ARGUMENT"}
+		}
+		for _, value := range u.enums[args[2]] {
+			resp = append(resp, fmt.Sprintf("ENUM %s %s %s", u.name, args[2], quote(value)))
+		}
+	case "RANGE":
+		if len(args) < 3 {
+			return []string{"ERR INVALID-ARGUMENT"}
+		}
+	default:
+		return []string{"ERR INVALID-ARGUMENT"}
+	}
+	return append(resp, "END LIST "+header)
+}
+
+func (s *Server) get(args []string) []string {
+	if len(args) < 2 {
+		return []string{"ERR INVALID-ARGUMENT"}
+	}
+	u := s.byName(args[1])
+	if u == nil {
+		return []string{"ERR UNKNOWN-UPS"}
+	}
+
+	switch args[0] {
+	case "UPSDESC":
+		return []string{fmt.Sprintf("UPSDESC %s %s", u.name, quote(u.description))}
+	case "NUMLOGINS":
+		return []string{fmt.Sprintf("NUMLOGINS %s 1", u.name)}
+	}
+	if len(args) < 3 {
+		return []string{"ERR INVALID-ARGUMENT"}
+	}
+	name := args[2]
+
+	switch args[0] {
+	case "VAR":
+		value, ok := u.vars[name]
+		if !ok {
+			return []string{"ERR VAR-NOT-SUPPORTED"}
+		}
+		return []string{fmt.Sprintf("VAR %s %s %s", u.name, name, quote(value))}
+	case "DESC":
+		return []string{fmt.Sprintf("DESC %s %s %s", u.name, name, quote(describe(name)))}
+	case "CMDDESC":
+		return []string{fmt.Sprintf("CMDDESC %s %s %s", u.name, name, quote(describe(name)))}
+	case "TYPE":
+		varType, ok := u.writeable[name]
+		if !ok {
+			varType = "NUMBER"
+			if _, err := strconv.ParseFloat(u.vars[name], 64); err != nil {
+				varType = "STRING:64"
+			}
+		}
+		return []string{fmt.Sprintf("TYPE %s %s %s", u.name, name, varType)}
+	}
+	return []string{"ERR INVALID-ARGUMENT"}
+}
+
+func (s *Server) setVar(args []string) []string {
+	if len(args) < 4 || args[0] != "VAR" {
+		return []string{"ERR INVALID-ARGUMENT"}
+	}
+	u := s.byName(args[1])
+	if u == nil {
+		return []string{"ERR UNKNOWN-UPS"}
+	}
+	name, value := args[2], args[3]
+	if _, ok := u.writeable[name]; !ok {
+		return []string{"ERR READONLY"}
+	}
+	if enum, ok := u.enums[name]; ok && !slices.Contains(enum, value) {
+		return []string{"ERR INVALID-VALUE"}
+	}
+	u.set(name, value)
+	return []string{"OK"}
+}
+
+// instcmd runs the command, the beeper, outlet and test commands change the variables they affect
+func (s *Server) instcmd(args []string) []string {
+	if len(args) < 2 {
+		return []string{"ERR INVALID-ARGUMENT"}
+	}
+	u := s.byName(args[0])
+	if u == nil {
+		return []string{"ERR UNKNOWN-UPS"}
+	}
+	cmd := args[1]
+	if !slices.Contains(u.commands, cmd) {
+		return []string{"ERR CMD-NOT-SUPPORTED"}
+	}
+
+	switch {
+	case cmd == "beeper.enable":
+		u.set("ups.beeper.status", "enabled")
+	case cmd == "beeper.disable":
+		u.set("ups.beeper.status", "disabled")
+	case cmd == "beeper.mute":
+		u.set("ups.beeper.status", "muted")
+	case strings.HasPrefix(cmd, "test.battery.start"):
+		u.set("ups.test.result", "Done and passed")
+	case strings.HasSuffix(cmd, ".load.off") && strings.HasPrefix(cmd, "outlet."):
+		u.set(strings.TrimSuffix(cmd, ".load.off")+".status", "off")
+	case strings.HasSuffix(cmd, ".load.on") && strings.HasPrefix(cmd, "outlet."):
+		u.set(strings.TrimSuffix(cmd, ".load.on")+".status", "on")
+	}
+	return []string{"OK"}
+}
+
+// describe returns a description of the variable or the command, made of its name
+func describe(name string) string {
+	return strings.ToUpper(name[:1]) + strings.ReplaceAll(name[1:], ".", " ")
+}
+
+// quote quotes the value for the response, escaping quotes and backslashes
+func quote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// fields splits the command into its arguments, quoted arguments may contain spaces
+func fields(line string) []string {
+	var args []string
+	var arg strings.Builder
+	inArg, quoted, escaped := false, false, false
+	for _, r := range line {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			inArg, escaped = true, true
+		case r == '"':
+			if quoted {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg, quoted = false, false
+				continue
+			}
+			inArg, quoted = true, true
+		case r == ' ' && !quoted:
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			inArg = true
+			arg.WriteRune(r)
+		}
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args
+}
@@ -0,0 +1,140 @@
+package digest
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"nutshell/pkg/notify"
+	"nutshell/pkg/nut"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxEvents limits the events of a single digest, a flapping UPS must not make it unreadable
+const maxEvents = 100
+
+// Digest collects the status changes, alarms and anomalies of the UPSs, and sends the summary of the fleet
+// to the notifier every day at the configured time. It's a notify.Notifier itself, registered as a collector
+// to get the events suppressed by the quiet hours too. The events are kept in memory, a restart loses them.
+type Digest struct {
+	Clients  []*nut.Client
+	Notifier notify.Notifier
+	// At is the time of the day in Location, e.g. 8h for 08:00
+	At       time.Duration
+	Location *time.Location
+
+	mu      sync.Mutex
+	since   time.Time
+	events  []notify.DigestEvent
+	dropped int
+}
+
+// Run sends the digest every day at the configured time until the context is canceled
+func (d *Digest) Run(ctx context.Context) {
+	d.mu.Lock()
+	d.since = time.Now()
+	d.mu.Unlock()
+
+	for {
+		next := d.next(time.Now())
+		log.Printf("[DEBUG] next digest at %s", next.Format(time.DateTime))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+			_ = d.Notifier.OnDigest(ctx, d.build(time.Now()))
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// next returns the time of the first digest after t
+func (d *Digest) next(t time.Time) time.Time {
+	t = t.In(d.Location)
+	hour, minute := int(d.At.Hours()), int(d.At.Minutes())%60
+	next := time.Date(t.Year(), t.Month(), t.Day(), hour, minute, 0, 0, d.Location)
+	if !next.After(t) {
+		next = time.Date(t.Year(), t.Month(), t.Day()+1, hour, minute, 0, 0, d.Location)
+	}
+	return next
+}
+
+// build returns the events since the previous digest and the current state of the UPSs, the events start again
+func (d *Digest) build(now time.Time) notify.Digest {
+	d.mu.Lock()
+	e := notify.Digest{Since: d.since, Time: now, Events: d.events, Dropped: d.dropped}
+	d.since, d.events, d.dropped = now, nil, 0
+	d.mu.Unlock()
+
+	for _, client := range d.Clients {
+		upss, err := client.UPSs()
+		if err != nil {
+			continue
+		}
+		for _, u := range upss {
+			if u.Gone() {
+				continue
+			}
+			_, status, _ := u.GetStatus()
+			charge, _ := u.IntVar("battery.charge")
+			runtime, _ := u.IntVar("battery.runtime")
+			e.UPSs = append(e.UPSs, notify.DigestUPS{
+				UPS:            notify.UPS{ID: u.ID, Name: u.Name, Server: u.Server},
+				Status:         status,
+				Charge:         charge,
+				Runtime:        runtime,
+				PeakLoad:       u.GetExtremes().PeakLoad.Value,
+				ReplaceBattery: slices.Contains(strings.Fields(status), "RB"),
+			})
+		}
+	}
+	sort.Slice(e.UPSs, func(i, j int) bool {
+		if e.UPSs[i].UPS.Server != e.UPSs[j].UPS.Server {
+			return e.UPSs[i].UPS.Server < e.UPSs[j].UPS.Server
+		}
+		return e.UPSs[i].UPS.Name < e.UPSs[j].UPS.Name
+	})
+	return e
+}
+
+// add keeps the event for the next digest, the events over maxEvents are counted only
+func (d *Digest) add(ups notify.UPS, t time.Time, message string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.events) >= maxEvents {
+		d.dropped++
+		return
+	}
+	d.events = append(d.events, notify.DigestEvent{UPS: ups, Message: message, Time: t})
+}
+
+func (d *Digest) OnStatusChange(_ context.Context, e notify.StatusChange) error {
+	d.add(e.UPS, e.Time, fmt.Sprintf("status changed from %q to %q", e.Previous, e.Status))
+	return nil
+}
+
+func (d *Digest) OnAlarm(_ context.Context, e notify.Alarm) error {
+	if e.Alarm == "" {
+		d.add(e.UPS, e.Time, fmt.Sprintf("alarm %q cleared", e.Previous))
+		return nil
+	}
+	d.add(e.UPS, e.Time, fmt.Sprintf("alarm %q", e.Alarm))
+	return nil
+}
+
+func (d *Digest) OnAnomaly(_ context.Context, e notify.Anomaly) error {
+	if !e.Active {
+		d.add(e.UPS, e.Time, fmt.Sprintf("%s anomaly cleared", e.Kind))
+		return nil
+	}
+	d.add(e.UPS, e.Time, e.Message)
+	return nil
+}
+
+func (d *Digest) OnPoll(context.Context, notify.Poll) error     { return nil }
+func (d *Digest) OnError(context.Context, notify.Error) error   { return nil }
+func (d *Digest) OnDigest(context.Context, notify.Digest) error { return nil }
@@ -0,0 +1,98 @@
+package digest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"nutshell/pkg/notify"
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	d := &Digest{At: 8 * time.Hour, Location: time.UTC}
+	tests := []struct {
+		now  time.Time
+		want time.Time
+	}{
+		{now: time.Date(2026, 3, 10, 7, 59, 0, 0, time.UTC), want: time.Date(2026, 3, 10, 8, 0, 0, 0, time.UTC)},
+		{now: time.Date(2026, 3, 10, 8, 0, 0, 0, time.UTC), want: time.Date(2026, 3, 11, 8, 0, 0, 0, time.UTC)},
+		{now: time.Date(2026, 3, 31, 23, 0, 0, 0, time.UTC), want: time.Date(2026, 4, 1, 8, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := d.next(tt.now); !got.Equal(tt.want) {
+			t.Errorf("next(%s) = %s, want %s", tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	d := &Digest{At: 8 * time.Hour, Location: time.UTC}
+	ctx := context.Background()
+	ups := notify.UPS{ID: "abc", Name: "ups", Server: "localhost:3493"}
+	_ = d.OnStatusChange(ctx, notify.StatusChange{UPS: ups, Previous: "OL", Status: "OB"})
+	_ = d.OnAlarm(ctx, notify.Alarm{UPS: ups, Previous: "Replace battery"})
+	_ = d.OnAnomaly(ctx, notify.Anomaly{UPS: ups, Kind: "stuck_battery", Active: true, Message: "battery is stuck"})
+	for i := 0; i < maxEvents; i++ {
+		_ = d.OnStatusChange(ctx, notify.StatusChange{UPS: ups, Previous: "OB", Status: fmt.Sprint("OL ", i)})
+	}
+
+	e := d.build(time.Now())
+	if len(e.Events) != maxEvents || e.Dropped != 3 {
+		t.Fatalf("%d events, %d dropped, want %d and 3", len(e.Events), e.Dropped, maxEvents)
+	}
+	want := []string{`status changed from "OL" to "OB"`, `alarm "Replace battery" cleared`, "battery is stuck"}
+	for i, message := range want {
+		if e.Events[i].Message != message {
+			t.Errorf("event %d = %q, want %q", i, e.Events[i].Message, message)
+		}
+	}
+	if e := d.build(time.Now()); len(e.Events) != 0 || e.Dropped != 0 {
+		t.Errorf("next digest has %d events, %d dropped, want none", len(e.Events), e.Dropped)
+	}
+}
+
+func TestDigestWebhook(t *testing.T) {
+	received := make(chan map[string]any, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["event"] == "digest" {
+			received <- body
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registry := &notify.Registry{}
+	registry.Register("webhook", notify.NewWebhook(server.URL, time.Second))
+	d := &Digest{Notifier: registry, At: 8 * time.Hour, Location: time.UTC}
+	registry.RegisterCollector("digest", d)
+	registry.Run(ctx)
+
+	_ = registry.OnStatusChange(ctx, notify.StatusChange{UPS: notify.UPS{Name: "ups"}, Previous: "OL", Status: "OB"})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		d.mu.Lock()
+		collected := len(d.events)
+		d.mu.Unlock()
+		if collected == 1 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	_ = d.Notifier.OnDigest(ctx, d.build(time.Now()))
+
+	select {
+	case body := <-received:
+		events, _ := body["data"].(map[string]any)["events"].([]any)
+		if len(events) != 1 {
+			t.Errorf("digest = %v, want 1 event", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("digest not posted to the webhook")
+	}
+}
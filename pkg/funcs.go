@@ -0,0 +1,135 @@
+package pkg
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// templateFuncs are the formatting helpers available in the templates
+var templateFuncs = template.FuncMap{
+	"humanizeDuration": humanizeDuration,
+	"humanizeWatts":    humanizeWatts,
+	"severityClass":    severityClass,
+	"percentBar":       percentBar,
+	"attr":             attr,
+}
+
+// humanizeDuration formats seconds or a time.Duration as e.g. "1h 5m", "30m" or "45s", pointers are dereferenced
+func humanizeDuration(value any) string {
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		value = v.Elem().Interface()
+	}
+
+	var d time.Duration
+	switch v := value.(type) {
+	case time.Duration:
+		d = v
+	case int:
+		d = time.Duration(v) * time.Second
+	case int64:
+		d = time.Duration(v) * time.Second
+	case float64:
+		d = time.Duration(v * float64(time.Second))
+	default:
+		return fmt.Sprint(value)
+	}
+
+	d = d.Round(time.Second)
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int64(d.Seconds()))
+	}
+	var parts []string
+	if h := int64(d.Hours()); h > 0 {
+		parts = append(parts, fmt.Sprintf("%dh", h))
+	}
+	if m := int64(d.Minutes()) % 60; m > 0 {
+		parts = append(parts, fmt.Sprintf("%dm", m))
+	}
+	if s := int64(d.Seconds()) % 60; s > 0 && d < time.Hour {
+		parts = append(parts, fmt.Sprintf("%ds", s))
+	}
+	return strings.Join(parts, " ")
+}
+
+// humanizeWatts formats the power as e.g. "230 W" or "1.2 kW"
+func humanizeWatts(value any) string {
+	var w float64
+	switch v := value.(type) {
+	case int:
+		w = float64(v)
+	case int64:
+		w = float64(v)
+	case float64:
+		w = v
+	default:
+		return fmt.Sprint(value)
+	}
+	if math.Abs(w) >= 1000 {
+		return fmt.Sprintf("%g kW", math.Round(w/100)/10)
+	}
+	return fmt.Sprintf("%g W", math.Round(w))
+}
+
+// StatusSeverity is the default severity of the NUT status flags: critical when the UPS is on battery
+// or about to cut the power, warning when it needs attention. The flags not listed are ok.
+var StatusSeverity = map[string]string{
+	"OB":     "critical",
+	"LB":     "critical",
+	"FSD":    "critical",
+	"OFF":    "critical",
+	"OVER":   "critical",
+	"COMM":   "critical",
+	"RB":     "warning",
+	"BYPASS": "warning",
+	"ALARM":  "warning",
+	"CAL":    "warning",
+	"TEST":   "warning",
+}
+
+// severityClass returns ok, warning or critical for the NUT status code, the most severe of its flags
+func severityClass(status string) string {
+	severity := "ok"
+	for _, flag := range strings.Fields(status) {
+		switch StatusSeverity[flag] {
+		case "critical":
+			return "critical"
+		case "warning":
+			severity = "warning"
+		}
+	}
+	return severity
+}
+
+// percentBar returns the width style of a bar filled to the percentage, clamped to 0-100
+func percentBar(value any) template.CSS {
+	var p float64
+	switch v := value.(type) {
+	case int:
+		p = float64(v)
+	case int64:
+		p = float64(v)
+	case float64:
+		p = v
+	}
+	return template.CSS(fmt.Sprintf("width: %g%%;", math.Max(0, math.Min(100, p))))
+}
+
+var safeAttr = regexp.MustCompile(`^(title|class|(data|aria)-[a-z0-9-]+)$`)
+
+// attr renders the attribute with the escaped value, nothing when the value is empty. Only title, class,
+// data-* and aria-* attributes are allowed, the others could run scripts or load resources.
+func attr(name string, value any) template.HTMLAttr {
+	s := fmt.Sprint(value)
+	if value == nil || s == "" || !safeAttr.MatchString(name) {
+		return ""
+	}
+	return template.HTMLAttr(fmt.Sprintf(` %s="%s"`, name, template.HTMLEscapeString(s)))
+}
@@ -0,0 +1,291 @@
+package notify
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// UPS identifies the UPS of the event
+type UPS struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Server string `json:"server"`
+}
+
+// StatusChange - the status of the UPS changed, e.g. from "OL" to "OB DISCHRG"
+type StatusChange struct {
+	UPS      UPS       `json:"ups"`
+	Previous string    `json:"previous"`
+	Status   string    `json:"status"`
+	Time     time.Time `json:"time"`
+}
+
+// Alarm - the alarm of the UPS appeared, changed or cleared. Alarm is empty when cleared, Previous is empty when
+// the alarm appeared. The text is "Alarm" when the UPS sets the ALARM flag without details in ups.alarm.
+type Alarm struct {
+	UPS      UPS       `json:"ups"`
+	Previous string    `json:"previous"`
+	Alarm    string    `json:"alarm"`
+	Time     time.Time `json:"time"`
+}
+
+// Anomaly - the UPS reports implausible values, e.g. a battery that doesn't discharge on battery. Active is false
+// when the anomaly is gone, Kind identifies the anomaly and Message describes it.
+type Anomaly struct {
+	UPS     UPS       `json:"ups"`
+	Kind    string    `json:"kind"`
+	Active  bool      `json:"active"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// Poll - the UPS was polled successfully
+type Poll struct {
+	UPS       UPS
+	Status    string
+	Variables map[string]any
+	Time      time.Time
+}
+
+// Error - the poll of the UPS failed
+type Error struct {
+	UPS  UPS
+	Err  error
+	Time time.Time
+}
+
+// Digest - the periodic summary of the fleet: the events since the previous digest and the current state of each UPS
+type Digest struct {
+	Since  time.Time     `json:"since"`
+	Time   time.Time     `json:"time"`
+	Events []DigestEvent `json:"events"`
+	// Dropped is the number of events over the limit of the digest, the oldest are kept
+	Dropped int         `json:"dropped"`
+	UPSs    []DigestUPS `json:"upss"`
+}
+
+// DigestEvent - a status change, alarm or anomaly in the digest
+type DigestEvent struct {
+	UPS     UPS       `json:"ups"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// DigestUPS - the state of the UPS in the digest, PeakLoad is the peak since the start or the reset of the extremes,
+// ReplaceBattery is set when the UPS reports RB
+type DigestUPS struct {
+	UPS            UPS     `json:"ups"`
+	Status         string  `json:"status"`
+	Charge         int64   `json:"charge"`
+	Runtime        int64   `json:"runtime"`
+	PeakLoad       float64 `json:"peak_load"`
+	ReplaceBattery bool    `json:"replace_battery"`
+}
+
+// Notifier receives the events of UPSs, e.g. sends them to a webhook. The returned error makes the registry
+// retry the event with a backoff.
+type Notifier interface {
+	OnStatusChange(ctx context.Context, e StatusChange) error
+	OnAlarm(ctx context.Context, e Alarm) error
+	OnAnomaly(ctx context.Context, e Anomaly) error
+	OnPoll(ctx context.Context, e Poll) error
+	OnError(ctx context.Context, e Error) error
+	OnDigest(ctx context.Context, e Digest) error
+}
+
+const (
+	queueSize = 64
+	retries   = 3
+)
+
+// backoffBase is the delay before the first retry of a failed event, doubled with every next one
+var backoffBase = time.Second
+
+// Registry fans out the events to all registered notifiers. Each notifier runs in its own goroutine with its own
+// queue, a slow or failing notifier doesn't block the poll loop or other notifiers. The registry is a Notifier itself,
+// its methods only enqueue the event and never fail.
+type Registry struct {
+	// QuietHours suppresses the status changes, alarms and anomalies in its windows, except the status changes
+	// to LB, FSD or COMM. The polls, the poll errors and the events for the collectors are always delivered. Optional.
+	QuietHours *Schedule
+
+	mu        sync.RWMutex
+	notifiers []*worker
+
+	quietMu    sync.Mutex
+	suppressed int
+}
+
+type worker struct {
+	name     string
+	notifier Notifier
+	queue    chan func(ctx context.Context) error
+	// collector receives the events suppressed by the quiet hours too
+	collector bool
+}
+
+// Register adds the notifier, it receives events after Run is called
+func (r *Registry) Register(name string, n Notifier) {
+	r.register(name, n, false)
+}
+
+// RegisterCollector adds the notifier receiving every event, also in the quiet hours, e.g. the digest
+// collecting the events for a later summary
+func (r *Registry) RegisterCollector(name string, n Notifier) {
+	r.register(name, n, true)
+}
+
+func (r *Registry) register(name string, n Notifier, collector bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifiers = append(r.notifiers, &worker{
+		name:      name,
+		notifier:  n,
+		queue:     make(chan func(ctx context.Context) error, queueSize),
+		collector: collector,
+	})
+}
+
+// Run delivers the queued events to the notifiers until the context is canceled
+func (r *Registry) Run(ctx context.Context) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, w := range r.notifiers {
+		go w.run(ctx)
+	}
+}
+
+func (r *Registry) OnStatusChange(_ context.Context, e StatusChange) error {
+	quiet := r.quiet(critical(e.Status), e.Time)
+	if quiet {
+		log.Printf("[DEBUG] quiet hours, status change of %s to %q not notified", e.UPS.Name, e.Status)
+	}
+	r.publishQuiet(quiet, func(n Notifier) func(ctx context.Context) error {
+		return func(ctx context.Context) error { return n.OnStatusChange(ctx, e) }
+	})
+	return nil
+}
+
+func (r *Registry) OnAlarm(_ context.Context, e Alarm) error {
+	quiet := r.quiet(false, e.Time)
+	if quiet {
+		log.Printf("[DEBUG] quiet hours, alarm of %s not notified", e.UPS.Name)
+	}
+	r.publishQuiet(quiet, func(n Notifier) func(ctx context.Context) error {
+		return func(ctx context.Context) error { return n.OnAlarm(ctx, e) }
+	})
+	return nil
+}
+
+func (r *Registry) OnAnomaly(_ context.Context, e Anomaly) error {
+	quiet := r.quiet(false, e.Time)
+	if quiet {
+		log.Printf("[DEBUG] quiet hours, %s anomaly of %s not notified", e.Kind, e.UPS.Name)
+	}
+	r.publishQuiet(quiet, func(n Notifier) func(ctx context.Context) error {
+		return func(ctx context.Context) error { return n.OnAnomaly(ctx, e) }
+	})
+	return nil
+}
+
+func (r *Registry) OnPoll(_ context.Context, e Poll) error {
+	r.publish(func(n Notifier) func(ctx context.Context) error {
+		return func(ctx context.Context) error { return n.OnPoll(ctx, e) }
+	})
+	return nil
+}
+
+func (r *Registry) OnError(_ context.Context, e Error) error {
+	r.publish(func(n Notifier) func(ctx context.Context) error {
+		return func(ctx context.Context) error { return n.OnError(ctx, e) }
+	})
+	return nil
+}
+
+func (r *Registry) OnDigest(_ context.Context, e Digest) error {
+	r.publish(func(n Notifier) func(ctx context.Context) error {
+		return func(ctx context.Context) error { return n.OnDigest(ctx, e) }
+	})
+	return nil
+}
+
+// quiet reports whether the event is suppressed by the quiet hours, critical events never are.
+// The number of suppressed events is logged with the first event after the quiet hours.
+func (r *Registry) quiet(critical bool, t time.Time) bool {
+	if r.QuietHours == nil {
+		return false
+	}
+	if t.IsZero() {
+		t = time.Now()
+	}
+	r.quietMu.Lock()
+	defer r.quietMu.Unlock()
+	if r.QuietHours.Active(t) {
+		if critical {
+			return false
+		}
+		r.suppressed++
+		return true
+	}
+	if r.suppressed > 0 {
+		log.Printf("[INFO] quiet hours are over, %d notifications were suppressed", r.suppressed)
+		r.suppressed = 0
+	}
+	return false
+}
+
+// publish enqueues the event for every notifier, the event is dropped for a notifier with a full queue
+func (r *Registry) publish(event func(n Notifier) func(ctx context.Context) error) {
+	r.publishQuiet(false, event)
+}
+
+// publishQuiet enqueues the event like publish, only for the collectors when quiet
+func (r *Registry) publishQuiet(quiet bool, event func(n Notifier) func(ctx context.Context) error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, w := range r.notifiers {
+		if quiet && !w.collector {
+			continue
+		}
+		select {
+		case w.queue <- event(w.notifier):
+		default:
+			log.Printf("[WARN] notifier %s is too slow, event dropped", w.name)
+		}
+	}
+}
+
+func (w *worker) run(ctx context.Context) {
+	for {
+		select {
+		case deliver := <-w.queue:
+			w.deliver(ctx, deliver)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deliver sends the event, retrying with an exponential backoff
+func (w *worker) deliver(ctx context.Context, deliver func(ctx context.Context) error) {
+	backoff := backoffBase
+	for attempt := 1; ; attempt++ {
+		err := deliver(ctx)
+		if err == nil {
+			return
+		}
+		if attempt == retries {
+			log.Printf("[ERROR] notifier %s failed after %d attempts: %v", w.name, attempt, err)
+			return
+		}
+		log.Printf("[DEBUG] notifier %s failed, retry in %s: %v", w.name, backoff, err)
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeNotifier - notifier of the tests failing the first fail attempts, it records the time of every attempt
+type fakeNotifier struct {
+	fail int
+
+	mu       sync.Mutex
+	attempts []time.Time
+	done     chan struct{}
+}
+
+func newFakeNotifier(fail int) *fakeNotifier {
+	return &fakeNotifier{fail: fail, done: make(chan struct{}, 1)}
+}
+
+func (f *fakeNotifier) attempt() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts = append(f.attempts, time.Now())
+	if len(f.attempts) <= f.fail {
+		if len(f.attempts) == retries {
+			f.done <- struct{}{}
+		}
+		return errors.New("unavailable")
+	}
+	f.done <- struct{}{}
+	return nil
+}
+
+func (f *fakeNotifier) times() []time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]time.Time(nil), f.attempts...)
+}
+
+func (f *fakeNotifier) OnStatusChange(context.Context, StatusChange) error { return f.attempt() }
+func (f *fakeNotifier) OnAlarm(context.Context, Alarm) error               { return f.attempt() }
+func (f *fakeNotifier) OnAnomaly(context.Context, Anomaly) error           { return f.attempt() }
+func (f *fakeNotifier) OnPoll(context.Context, Poll) error                 { return f.attempt() }
+func (f *fakeNotifier) OnError(context.Context, Error) error               { return f.attempt() }
+func (f *fakeNotifier) OnDigest(context.Context, Digest) error             { return f.attempt() }
+
+func withBackoff(t *testing.T, d time.Duration) {
+	t.Helper()
+	previous := backoffBase
+	backoffBase = d
+	t.Cleanup(func() { backoffBase = previous })
+}
+
+func TestRegistryRetry(t *testing.T) {
+	withBackoff(t, 20*time.Millisecond)
+	tests := []struct {
+		name     string
+		fail     int
+		attempts int
+	}{
+		{name: "delivered", fail: 0, attempts: 1},
+		{name: "delivered after a retry", fail: 1, attempts: 2},
+		{name: "delivered on the last attempt", fail: 2, attempts: 3},
+		{name: "dropped after the retries", fail: 5, attempts: retries},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			n := newFakeNotifier(tt.fail)
+			r := &Registry{}
+			r.Register("fake", n)
+			r.Run(ctx)
+
+			_ = r.OnStatusChange(ctx, StatusChange{UPS: UPS{Name: "ups"}, Previous: "OL", Status: "OB"})
+			select {
+			case <-n.done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("event not delivered")
+			}
+			// no attempt after the last one
+			time.Sleep(100 * time.Millisecond)
+
+			attempts := n.times()
+			if len(attempts) != tt.attempts {
+				t.Fatalf("%d attempts, want %d", len(attempts), tt.attempts)
+			}
+			backoff := backoffBase
+			for i := 1; i < len(attempts); i++ {
+				if gap := attempts[i].Sub(attempts[i-1]); gap < backoff {
+					t.Errorf("retry %d after %s, want at least %s", i, gap, backoff)
+				}
+				backoff *= 2
+			}
+		})
+	}
+}
+
+func TestRegistryRetryCanceled(t *testing.T) {
+	withBackoff(t, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	n := newFakeNotifier(5)
+	r := &Registry{}
+	r.Register("fake", n)
+	r.Run(ctx)
+
+	_ = r.OnAlarm(ctx, Alarm{UPS: UPS{Name: "ups"}, Alarm: "Replace battery"})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(n.times()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	if attempts := len(n.times()); attempts != 1 {
+		t.Errorf("%d attempts, want 1, the backoff must end with the context", attempts)
+	}
+}
+
+func TestRegistryQuietHours(t *testing.T) {
+	schedule, err := ParseSchedule("00:00-24:00", "UTC")
+	if err != nil {
+		t.Fatalf("ParseSchedule: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n, collector := newFakeNotifier(0), newFakeNotifier(0)
+	r := &Registry{QuietHours: schedule}
+	r.Register("fake", n)
+	r.RegisterCollector("collector", collector)
+	r.Run(ctx)
+
+	_ = r.OnStatusChange(ctx, StatusChange{UPS: UPS{Name: "ups"}, Previous: "OL", Status: "OB"})
+	<-collector.done
+	_ = r.OnStatusChange(ctx, StatusChange{UPS: UPS{Name: "ups"}, Previous: "OB", Status: "OB LB"})
+	<-n.done
+	<-collector.done
+
+	if attempts := len(n.times()); attempts != 1 {
+		t.Errorf("notifier got %d events, want only the critical one", attempts)
+	}
+	if attempts := len(collector.times()); attempts != 2 {
+		t.Errorf("collector got %d events, want 2", attempts)
+	}
+}
@@ -0,0 +1,161 @@
+package notify
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Schedule - the quiet hours, the notifications that aren't critical are suppressed within any of the windows
+type Schedule struct {
+	Windows  []Window
+	Location *time.Location
+}
+
+// Window - the time of the day from From to To, on the Days (every day when empty). To before From spans midnight,
+// the window then belongs to the day it starts on.
+type Window struct {
+	Days []time.Weekday
+	From time.Duration
+	To   time.Duration
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseSchedule parses the windows separated by semicolons, e.g. "22:00-07:00" or "mon-fri 22:00-06:00; sat,sun 00:00-24:00",
+// in the time zone, the local one when empty
+func ParseSchedule(spec, tz string) (*Schedule, error) {
+	s := &Schedule{Location: time.Local}
+	if tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone %q: %w", tz, err)
+		}
+		s.Location = loc
+	}
+
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		w, err := parseWindow(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quiet hours %q: %w", part, err)
+		}
+		s.Windows = append(s.Windows, w)
+	}
+	if len(s.Windows) == 0 {
+		return nil, fmt.Errorf("no quiet hours in %q", spec)
+	}
+	return s, nil
+}
+
+func parseWindow(spec string) (Window, error) {
+	var w Window
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 1:
+	case 2:
+		days, err := parseDays(fields[0])
+		if err != nil {
+			return w, err
+		}
+		w.Days = days
+	default:
+		return w, fmt.Errorf("expected [days] HH:MM-HH:MM")
+	}
+
+	from, to, ok := strings.Cut(fields[len(fields)-1], "-")
+	if !ok {
+		return w, fmt.Errorf("expected HH:MM-HH:MM")
+	}
+	var err error
+	if w.From, err = parseClock(from); err != nil {
+		return w, err
+	}
+	if w.To, err = parseClock(to); err != nil {
+		return w, err
+	}
+	if w.From == w.To {
+		return w, fmt.Errorf("empty window")
+	}
+	return w, nil
+}
+
+// parseDays parses the weekdays like "sat,sun" or ranges like "mon-fri"
+func parseDays(spec string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	for _, part := range strings.Split(strings.ToLower(spec), ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		from, ok := weekdays[first]
+		if !ok {
+			return nil, fmt.Errorf("unknown weekday %q", first)
+		}
+		to := from
+		if isRange {
+			if to, ok = weekdays[last]; !ok {
+				return nil, fmt.Errorf("unknown weekday %q", last)
+			}
+		}
+		for d := from; ; d = (d + 1) % 7 {
+			days = append(days, d)
+			if d == to {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseClock parses HH:MM as the time since midnight, 24:00 is the end of the day
+func parseClock(spec string) (time.Duration, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(spec, "%d:%d", &h, &m); err != nil || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", spec)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// Active reports whether the time is within any of the windows
+func (s *Schedule) Active(t time.Time) bool {
+	t = t.In(s.Location)
+	since := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	day := t.Weekday()
+	yesterday := (day + 6) % 7
+	for _, w := range s.Windows {
+		if w.From < w.To {
+			if w.on(day) && since >= w.From && since < w.To {
+				return true
+			}
+			continue
+		}
+		// spans midnight, the morning part belongs to the window started yesterday
+		if (w.on(day) && since >= w.From) || (w.on(yesterday) && since < w.To) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w Window) on(day time.Weekday) bool {
+	return len(w.Days) == 0 || slices.Contains(w.Days, day)
+}
+
+// criticalFlags are the status flags notified in the quiet hours, the UPS is about to cut the power
+// or its state is unknown
+var criticalFlags = []string{"LB", "FSD", "COMM"}
+
+// critical reports whether the status has any of the critical flags
+func critical(status string) bool {
+	for _, flag := range strings.Fields(status) {
+		if slices.Contains(criticalFlags, flag) {
+			return true
+		}
+	}
+	return false
+}
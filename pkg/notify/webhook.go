@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Webhook posts the status changes, alarms, anomalies and digests as JSON to the URL, e.g.
+// {"event": "status_change", "data": {"ups": {...}, "previous": "OL", "status": "OB DISCHRG", ...}}.
+// The polls and the poll errors are not posted, they would flood the endpoint with every poll.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// payload - the body of the webhook request
+type payload struct {
+	Event string `json:"event"`
+	Data  any    `json:"data"`
+}
+
+// NewWebhook returns the webhook posting to the URL, every request has the timeout
+func NewWebhook(url string, timeout time.Duration) *Webhook {
+	return &Webhook{URL: url, Client: &http.Client{Timeout: timeout}}
+}
+
+func (w *Webhook) OnStatusChange(ctx context.Context, e StatusChange) error {
+	return w.post(ctx, "status_change", e)
+}
+
+func (w *Webhook) OnAlarm(ctx context.Context, e Alarm) error {
+	return w.post(ctx, "alarm", e)
+}
+
+func (w *Webhook) OnAnomaly(ctx context.Context, e Anomaly) error {
+	return w.post(ctx, "anomaly", e)
+}
+
+func (w *Webhook) OnPoll(context.Context, Poll) error   { return nil }
+func (w *Webhook) OnError(context.Context, Error) error { return nil }
+
+func (w *Webhook) OnDigest(ctx context.Context, e Digest) error {
+	return w.post(ctx, "digest", e)
+}
+
+// post sends the event, a response other than 2xx is an error retried by the registry
+func (w *Webhook) post(ctx context.Context, event string, data any) error {
+	body, err := json.Marshal(payload{Event: event, Data: data})
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", event, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post %s: %w", event, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("post %s: webhook responded with %s", event, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhook(t *testing.T) {
+	var got []map[string]any
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("request %s with %q, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+		}
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		got = append(got, body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	w := NewWebhook(server.URL, time.Second)
+	ctx := context.Background()
+	ups := UPS{ID: "abc", Name: "ups", Server: "localhost:3493"}
+	if err := w.OnStatusChange(ctx, StatusChange{UPS: ups, Previous: "OL", Status: "OB DISCHRG"}); err != nil {
+		t.Fatalf("OnStatusChange: %v", err)
+	}
+	if err := w.OnPoll(ctx, Poll{UPS: ups}); err != nil {
+		t.Fatalf("OnPoll: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("%d requests, want 1, the polls are not posted", len(got))
+	}
+	data, _ := got[0]["data"].(map[string]any)
+	if got[0]["event"] != "status_change" || data["status"] != "OB DISCHRG" || data["ups"].(map[string]any)["name"] != "ups" {
+		t.Errorf("body = %v", got[0])
+	}
+
+	status = http.StatusBadGateway
+	err := w.OnAlarm(ctx, Alarm{UPS: ups, Alarm: "Replace battery"})
+	if err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("OnAlarm error = %v, want the status of the response", err)
+	}
+}
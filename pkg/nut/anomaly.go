@@ -0,0 +1,86 @@
+package nut
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// AnomalyStuckBattery is the kind of the anomaly of a UPS on battery with the charge and the runtime not dropping
+const AnomalyStuckBattery = "stuck-battery"
+
+// defaultStuckBatteryDrop is the charge drop in percent expected while on battery for StuckBatteryAfter
+const defaultStuckBatteryDrop = 1
+
+// discharge - the charge and the runtime at the start of the power outage, ok is false for a value not reported
+type discharge struct {
+	since     time.Time
+	charge    int64
+	chargeOK  bool
+	runtime   int64
+	runtimeOK bool
+}
+
+// StuckBattery returns the start of the power outage and whether the UPS has been on battery for StuckBatteryAfter
+// without the charge and the runtime dropping, usually a driver reporting frozen values
+func (u *UPS) StuckBattery() (time.Time, bool) {
+	u.anomalyMu.Lock()
+	defer u.anomalyMu.Unlock()
+	return u.discharge.since, u.stuck
+}
+
+// detectStuckBattery compares the charge and the runtime with the ones at the start of the power outage.
+// The charge must drop by StuckBatteryDrop percent and the runtime must drop at all, values not reported are skipped.
+func (u *UPS) detectStuckBattery() {
+	if u.updateStuckBattery() {
+		log.Printf("[WARN] %s", u.StuckBatteryMessage())
+	}
+}
+
+// updateStuckBattery updates the stuck battery state and reports whether the battery got stuck
+func (u *UPS) updateStuckBattery() bool {
+	after := u.Client.stuckBatteryAfter
+	_, status, _ := u.GetStatus()
+	charge, chargeOK := u.IntVar("battery.charge")
+	runtime, runtimeOK := u.IntVar("battery.runtime")
+
+	u.anomalyMu.Lock()
+	defer u.anomalyMu.Unlock()
+	if after <= 0 || !onBattery(status) {
+		u.discharge = discharge{}
+		u.stuck = false
+		return false
+	}
+
+	if u.discharge.since.IsZero() {
+		u.discharge = discharge{since: time.Now(), charge: charge, chargeOK: chargeOK, runtime: runtime, runtimeOK: runtimeOK}
+		return false
+	}
+	if time.Since(u.discharge.since) < after || (!chargeOK && !runtimeOK) {
+		return false
+	}
+
+	stuck := true
+	if chargeOK && u.discharge.chargeOK && u.discharge.charge-charge >= u.Client.stuckBatteryDrop {
+		stuck = false
+	}
+	if runtimeOK && u.discharge.runtimeOK && runtime < u.discharge.runtime {
+		stuck = false
+	}
+	stuckNow := stuck && !u.stuck
+	u.stuck = stuck
+	return stuckNow
+}
+
+// StuckBatteryMessage describes the stuck battery, e.g. for the notification and the UI
+func (u *UPS) StuckBatteryMessage() string {
+	value := "the charge and the runtime don't drop"
+	if charge, ok := u.IntVar("battery.charge"); ok {
+		value = fmt.Sprintf("the charge stays at %d%%", charge)
+	} else if runtime, ok := u.IntVar("battery.runtime"); ok {
+		value = fmt.Sprintf("the runtime stays at %s", time.Duration(runtime)*time.Second)
+	}
+	since, _ := u.StuckBattery()
+	return fmt.Sprintf("%s is on battery for %s but %s, the driver may report frozen values",
+		u.Name, time.Since(since).Truncate(time.Second), value)
+}
@@ -0,0 +1,40 @@
+package nut
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDetectStuckBattery(t *testing.T) {
+	device := &fakeDevice{Name: "ups", Vars: map[string]string{"ups.status": "OB DISCHRG", "battery.charge": "80", "battery.runtime": "600"}}
+	server := newFakeUPSD(t, device)
+	ups := server.ups(t, server.client(t, Config{StuckBatteryAfter: 10 * time.Millisecond}), "ups")
+
+	defer readConcurrently(func() {
+		_, _ = ups.StuckBattery()
+		_ = ups.StuckBatteryMessage()
+	})()
+
+	ups.PollIfOlder(0)
+	since, stuck := ups.StuckBattery()
+	if since.IsZero() || stuck {
+		t.Fatalf("outage not started: since %v, stuck %v", since, stuck)
+	}
+	time.Sleep(20 * time.Millisecond)
+	ups.PollIfOlder(0)
+	if _, stuck := ups.StuckBattery(); !stuck {
+		t.Error("battery not stuck with the charge and the runtime not dropping")
+	}
+
+	server.update(func(s *fakeUPSD) { device.Vars["battery.charge"] = "70" })
+	ups.PollIfOlder(0)
+	if _, stuck := ups.StuckBattery(); stuck {
+		t.Error("battery stuck with the charge dropping")
+	}
+
+	server.update(func(s *fakeUPSD) { device.Vars["ups.status"] = "OL CHRG" })
+	ups.PollIfOlder(0)
+	if since, stuck := ups.StuckBattery(); !since.IsZero() || stuck {
+		t.Errorf("outage not reset on line power: since %v, stuck %v", since, stuck)
+	}
+}
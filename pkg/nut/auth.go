@@ -0,0 +1,74 @@
+package nut
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+)
+
+// Auth failure actions define what happens when the server rejects the credentials on a reconnect:
+// stop stops connecting to the server until a restart, the same credentials can't succeed, and retry
+// reconnects like after a connection failure, e.g. while the users of upsd are being reloaded.
+const (
+	AuthFailureStop  = "stop"
+	AuthFailureRetry = "retry"
+)
+
+// authErrorCodes are the errors of the server rejecting the credentials
+var authErrorCodes = []string{"ACCESS-DENIED", "USERNAME-REQUIRED", "PASSWORD-REQUIRED", "INVALID-USERNAME", "INVALID-PASSWORD"}
+
+// AuthError - the server rejected the username or the password, a configuration error
+type AuthError struct {
+	Server string
+	Err    error
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("%s rejected the credentials, check the username and password: %v", e.Server, e.Err)
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// isAuthFailure reports whether the server rejected the credentials, rather than the connection failing
+func isAuthFailure(err error) bool {
+	var nutErr *Error
+	return errors.As(err, &nutErr) && slices.Contains(authErrorCodes, nutErr.Code)
+}
+
+// isAuthError reports whether the error is the rejected credentials
+func isAuthError(err error) bool {
+	var authErr *AuthError
+	return errors.As(err, &authErr)
+}
+
+// authFailed returns the error of the rejected credentials. With the stop action, connecting to the server
+// is stopped after a reconnect fails, the connections return the error without dialing.
+func (c *Client) authFailed(err error, reconnect bool) error {
+	authErr := &AuthError{Server: fmt.Sprintf("%s:%s", c.hostname, c.port), Err: err}
+	if !reconnect || c.authFailureAction != AuthFailureStop {
+		return authErr
+	}
+	if c.authErr.CompareAndSwap(nil, authErr) {
+		log.Printf("[ERROR] %v, connecting stopped until a restart", authErr)
+	}
+	return authErr
+}
+
+// AuthError returns the error of the rejected credentials that stopped connecting to the server, nil otherwise
+func (c *Client) AuthError() error {
+	if err := c.authErr.Load(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// AuthError returns the error of the rejected credentials of the server of the UPS, see Client.AuthError
+func (u *UPS) AuthError() error {
+	if u.Client == nil {
+		return nil
+	}
+	return u.Client.AuthError()
+}
@@ -0,0 +1,66 @@
+package nut
+
+import (
+	"strings"
+)
+
+// Charger states of battery.charger.status: charging the battery, discharging it, keeping it charged with
+// the float voltage, or resting without charging, e.g. between the float cycles of lithium batteries
+const (
+	ChargerCharging    = "charging"
+	ChargerDischarging = "discharging"
+	ChargerFloating    = "floating"
+	ChargerResting     = "resting"
+)
+
+// chargerStates maps the values drivers use for battery.charger.status to the charger states, the stages
+// of multi-stage charging (bulk, absorption) are charging
+var chargerStates = map[string]string{
+	"charging":    ChargerCharging,
+	"charge":      ChargerCharging,
+	"bulk":        ChargerCharging,
+	"absorption":  ChargerCharging,
+	"absorbing":   ChargerCharging,
+	"boost":       ChargerCharging,
+	"fast":        ChargerCharging,
+	"discharging": ChargerDischarging,
+	"discharge":   ChargerDischarging,
+	"floating":    ChargerFloating,
+	"float":       ChargerFloating,
+	"trickle":     ChargerFloating,
+	"maintenance": ChargerFloating,
+	"resting":     ChargerResting,
+	"rest":        ChargerResting,
+	"idle":        ChargerResting,
+	"standby":     ChargerResting,
+}
+
+// ChargerHumanReadable describes the charger states in the status of the UPS
+var ChargerHumanReadable = map[string]string{
+	ChargerCharging:    "Charging",
+	ChargerDischarging: "Discharging",
+	ChargerFloating:    "Float charging",
+	ChargerResting:     "Battery resting",
+}
+
+// ChargerDescription describes the charger state, the states unknown to nutshell as reported
+func ChargerDescription(state string) string {
+	if desc, ok := ChargerHumanReadable[state]; ok {
+		return desc
+	}
+	return "Charger " + state
+}
+
+// GetChargerStatus returns the state of the battery charger from battery.charger.status, one of the Charger
+// constants or the reported value in lower case when unknown. False when the driver doesn't report it.
+func (u *UPS) GetChargerStatus() (string, bool) {
+	value, ok := u.StringVar("battery.charger.status")
+	value = strings.ToLower(strings.TrimSpace(value))
+	if !ok || value == "" {
+		return "", false
+	}
+	if state, ok := chargerStates[value]; ok {
+		return state, true
+	}
+	return value, true
+}
@@ -0,0 +1,98 @@
+package nut
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReconnectUpdatesUPSList(t *testing.T) {
+	first := &fakeDevice{Name: "ups1", Vars: map[string]string{"ups.status": "OL"}}
+	second := &fakeDevice{Name: "ups2", Vars: map[string]string{"ups.status": "OL"}}
+	added := &fakeDevice{Name: "ups3", Vars: map[string]string{"ups.status": "OB"}}
+	server := newFakeUPSD(t, first, second)
+	client := server.client(t, Config{})
+	ups1, ups2 := server.ups(t, client, "ups1"), server.ups(t, client, "ups2")
+	defer readConcurrently(func() {
+		_ = ups2.Gone()
+		_ = ups2.Healthy()
+	})()
+
+	// the server is restarted with another configuration, the next command reconnects
+	server.update(func(s *fakeUPSD) { s.devices = []*fakeDevice{first, added} })
+	server.dropConnections()
+	ups1.PollIfOlder(0)
+	if !ups1.Healthy() {
+		t.Fatalf("ups1 not polled after the reconnect: %+v", ups1.Failures())
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for (client.byName("ups3") == nil || !ups2.Gone()) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !ups2.Gone() {
+		t.Error("ups2 removed from the server is not gone")
+	}
+	if ups3 := client.byName("ups3"); ups3 == nil {
+		t.Error("ups3 added to the server is not listed")
+	} else if status, _, _ := ups3.GetStatus(); status == "" {
+		t.Error("ups3 has no status")
+	}
+	if ups1.Gone() {
+		t.Error("ups1 still served is gone")
+	}
+	if ups, err := client.UPSs(); err != nil || len(ups) != 3 {
+		t.Errorf("UPSs = %d, %v, want ups1, the gone ups2 and ups3", len(ups), err)
+	}
+}
+
+func TestServerVersionWhileReconnecting(t *testing.T) {
+	server := newFakeUPSD(t, writeableDevice())
+	client := server.client(t, Config{})
+
+	// the handlers read the version while the poll reconnects, the race detector catches unguarded writes
+	stop := readConcurrently(func() { _, _ = client.ServerVersion() })
+	for range 10 {
+		if err := client.Reconnect(); err != nil {
+			t.Fatalf("Reconnect: %v", err)
+		}
+	}
+	stop()
+	if version, protocol := client.ServerVersion(); version != "2.8.1" || protocol != "1.3" {
+		t.Errorf("ServerVersion = %q, %q, want 2.8.1 and 1.3", version, protocol)
+	}
+}
+
+func TestCRLFResponses(t *testing.T) {
+	device := writeableDevice()
+	device.Cmds = []string{"beeper.mute"}
+	server := newFakeUPSD(t, device)
+	server.update(func(s *fakeUPSD) { s.lineEnd = "\r\n" })
+	client := server.client(t, Config{})
+	ups := server.ups(t, client, "ups")
+
+	if version, protocol := client.ServerVersion(); version != "2.8.1" || protocol != "1.3" {
+		t.Errorf("ServerVersion = %q, %q, want 2.8.1 and 1.3", version, protocol)
+	}
+	if ups.Description != "Test UPS" {
+		t.Errorf("Description = %q", ups.Description)
+	}
+	for _, v := range ups.CurrentVariables() {
+		if s, ok := v.Value.(string); ok && strings.ContainsAny(s, "\r\n") {
+			t.Errorf("variable %s = %q has the line end", v.Name, s)
+		}
+	}
+	if _, status, _ := ups.GetStatus(); status != "OL" {
+		t.Errorf("status = %q, want OL", status)
+	}
+	if value, err := ups.GetVariableValue("ups.id"); err != nil || value != "rack" {
+		t.Errorf("GetVariableValue = %q, %v, want rack", value, err)
+	}
+	if commands, err := ups.GetCommands(); err != nil || len(commands) != 1 || commands[0].Name != "beeper.mute" {
+		t.Errorf("GetCommands = %+v, %v", commands, err)
+	}
+	// the responses are read one by one, nothing is left over for the next command
+	if _, err := ups.SendCommand("beeper.mute"); err != nil {
+		t.Errorf("SendCommand: %v", err)
+	}
+}
@@ -0,0 +1,545 @@
+package nut
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Error - error reported by the NUT server in the ERR response
+type Error struct {
+	Code string
+}
+
+func (e *Error) Error() string {
+	return e.Code
+}
+
+// isServerError reports whether the error was reported by the server, rather than a connection failure
+func isServerError(err error) bool {
+	var nutErr *Error
+	return errors.As(err, &nutErr)
+}
+
+// isTimeout reports whether the command failed because the server didn't respond in time
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// isErrorCode reports whether the server reported the error with the code, e.g. UNKNOWN-UPS
+func isErrorCode(err error, code string) bool {
+	var nutErr *Error
+	return errors.As(err, &nutErr) && nutErr.Code == code
+}
+
+// retryable reports whether the command only reads and can be sent again after the connection failed.
+// INSTCMD, SET VAR, FSD and the like may have been executed before the failure, they are never repeated.
+func retryable(cmd string) bool {
+	verb, _, _ := strings.Cut(cmd, " ")
+	switch verb {
+	case "GET", "LIST", "VER", "NETVER":
+		return true
+	}
+	return false
+}
+
+// pendingResponse - end of the response that timed out
+type pendingResponse struct {
+	endLine   string
+	multiLine bool
+}
+
+// connection - single authenticated connection to the NUT server.
+// Commands on the connection are serialized, one command and its response at a time.
+type connection struct {
+	client *Client
+
+	// conn is the TCP connection to the server or the one through the proxy
+	conn   net.Conn
+	reader *bufio.Reader
+	mu     sync.Mutex
+
+	// version and protocolVersion are the parsed numbers, the banners are the responses as sent by the server
+	version         string
+	protocolVersion string
+	versionBanner   string
+	protocolBanner  string
+	// pending is the response that timed out, the rest of it may still arrive
+	pending *pendingResponse
+	// dialed is set after the first connect, the UPS list is updated after every reconnect
+	dialed bool
+	// broken is set when the rest of a response was left unread, the next command reopens the connection
+	broken bool
+}
+
+func newConnection(client *Client) (*connection, error) {
+	c := &connection{client: client}
+	if err := c.dial(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// dial (re)opens the connection and does the authentication and version handshake
+func (c *connection) dial() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connect()
+}
+
+// connect (re)opens the connection like dial, the caller must hold the lock
+func (c *connection) connect() error {
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+	// the credentials were rejected, dialing again with them can't succeed
+	if err := c.client.AuthError(); err != nil {
+		return err
+	}
+
+	conn, err := c.client.dialTCP()
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.reader = newReader(conn, c.client.maxLineLength)
+	c.pending = nil
+	c.broken = false
+
+	status, err := c.authenticate(c.client.username, c.client.password)
+	if isAuthFailure(err) {
+		_ = conn.Close()
+		return c.client.authFailed(err, c.dialed)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to authenticate: %s", err)
+	}
+	if !status {
+		return fmt.Errorf("authentication failed, check username and password")
+	}
+	if err := c.getVersion(); err != nil {
+		return fmt.Errorf("failed to get version: %s", err)
+	}
+	if err := c.getNetworkProtocolVersion(); err != nil {
+		return fmt.Errorf("failed to get network protocol version: %s", err)
+	}
+
+	// upsd shows sessions by the username and the client address only, there is no command naming the client,
+	// log the local address so the session of nutshell can be found in LIST CLIENT and upsd logs
+	log.Printf("[DEBUG] connected to %s:%s as %s from %s", c.client.hostname, c.client.port, c.client.username, conn.LocalAddr())
+
+	// the UPSs may have changed while disconnected, the list is updated without holding the connection
+	if c.dialed {
+		go c.client.reconcile()
+	}
+	c.dialed = true
+	c.client.connects.Add(1)
+
+	return nil
+}
+
+func (c *connection) logout() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// the connection is already closed, there is no session to end
+	if c.broken {
+		return nil
+	}
+	resp, err := c.send("LOGOUT")
+	if errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) {
+		// some upsd versions close the connection without the goodbye
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to send logout: %s", err)
+	}
+	if len(resp) <= 0 || (resp[0] != "OK Goodbye" && resp[0] != "Goodbye...") {
+		return fmt.Errorf("logout did not succeed")
+	}
+	return nil
+}
+
+func (c *connection) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+}
+
+func (c *connection) remoteAddr() net.Addr {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.RemoteAddr()
+}
+
+// do sends the command, reopening the connection and retrying once when the connection fails.
+// Errors reported by the server, timeouts with the skip action, responses over the limits and failures
+// of the commands that aren't retryable are returned without retry. The failed connection is closed then,
+// the next command reopens it.
+func (c *connection) do(cmd string) ([]string, error) {
+	resp, err := c.sendCommand(cmd)
+	if err == nil || isServerError(err) || exceedsLimit(err) || c.client.keepsConnection(err) || !retryable(cmd) {
+		return resp, err
+	}
+
+	log.Printf("[DEBUG] reconnect to %s:%s after failed command: %v", c.client.hostname, c.client.port, err)
+	if err := c.dial(); err != nil {
+		return nil, fmt.Errorf("failed to reconnect: %w", err)
+	}
+	return c.sendCommand(cmd)
+}
+
+// sendCommand sends a command to the NUT server and waits for the response
+func (c *connection) sendCommand(cmd string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.reopen(); err != nil {
+		return nil, err
+	}
+	return c.send(cmd)
+}
+
+// reopen reconnects when the connection is broken, the caller must hold the lock
+func (c *connection) reopen() error {
+	if !c.broken {
+		return nil
+	}
+	log.Printf("[DEBUG] reconnect to %s:%s, the previous response was left unread", c.client.hostname, c.client.port)
+	if err := c.connect(); err != nil {
+		return fmt.Errorf("failed to reconnect: %w", err)
+	}
+	return nil
+}
+
+// abandon closes the connection after a failed command, with the rest of the response unread, the next command reopens it
+func (c *connection) abandon() {
+	c.broken = true
+	c.pending = nil
+	_ = c.conn.Close()
+}
+
+// doStream streams the response of the command like do. The command is retried after a failed connection,
+// fn then gets the lines of the new response from the start, the BEGIN line for LIST commands.
+func (c *connection) doStream(cmd string, fn func(line string)) error {
+	err := c.streamCommand(cmd, fn)
+	if err == nil || isServerError(err) || exceedsLimit(err) || c.client.keepsConnection(err) || !retryable(cmd) {
+		return err
+	}
+
+	log.Printf("[DEBUG] reconnect to %s:%s after failed command: %v", c.client.hostname, c.client.port, err)
+	if err := c.dial(); err != nil {
+		return fmt.Errorf("failed to reconnect: %w", err)
+	}
+	return c.streamCommand(cmd, fn)
+}
+
+// streamCommand sends a command to the NUT server and calls fn with each line of the response as it's read
+func (c *connection) streamCommand(cmd string, fn func(line string)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.reopen(); err != nil {
+		return err
+	}
+	return c.stream(cmd, fn)
+}
+
+// send writes the command and reads the response, the caller must hold the lock
+func (c *connection) send(cmd string) ([]string, error) {
+	var resp []string
+	if err := c.stream(cmd, func(line string) { resp = append(resp, line) }); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// stream writes the command and calls fn with each line of the response, the caller must hold the lock.
+// The lines are not kept, so large LIST responses can be parsed without buffering them.
+// An error reported by the server is returned without calling fn.
+func (c *connection) stream(cmd string, fn func(line string)) (err error) {
+	defer func() {
+		if err != nil {
+			c.client.stats.errors.Add(1)
+			// only a complete ERR response and a kept timeout leave the connection in sync with the server
+			if !isServerError(err) && !c.client.keepsConnection(err) {
+				c.abandon()
+			}
+		}
+	}()
+	if c.pending != nil {
+		if err := c.drain(); err != nil {
+			return err
+		}
+	}
+
+	cmd = fmt.Sprintf("%v\n", cmd)
+	endLine := fmt.Sprintf("END %s", cmd)
+	if strings.HasPrefix(cmd, "USERNAME ") || strings.HasPrefix(cmd, "PASSWORD ") || strings.HasPrefix(cmd, "SET ") || strings.HasPrefix(cmd, "HELP ") || strings.HasPrefix(cmd, "VER ") || strings.HasPrefix(cmd, "NETVER ") {
+		endLine = "OK\n"
+	}
+	c.client.stats.commands.Add(1)
+	n, err := fmt.Fprint(c.conn, cmd)
+	c.client.stats.sent.Add(int64(n))
+	if err != nil {
+		return fmt.Errorf("failed to send command: %s", err)
+	}
+
+	lines := 0
+	err = c.readLines(endLine, strings.HasPrefix(cmd, "LIST "), func(line string) error {
+		lines++
+		// the error is the only line of the response
+		if lines == 1 && strings.HasPrefix(line, "ERR ") {
+			return &Error{Code: strings.Split(line, " ")[1]}
+		}
+		fn(line)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if lines == 0 {
+		// the command name only, the arguments of PASSWORD must not get into the logs
+		return fmt.Errorf("empty response to %s", strings.Fields(cmd)[0])
+	}
+	return nil
+}
+
+// pipelineCommand - a command with a single line response written in a pipeline, prefix is the start
+// of its response, e.g. "DESC ups battery.charge " for "GET DESC ups battery.charge"
+type pipelineCommand struct {
+	cmd    string
+	prefix string
+}
+
+// pipelined - the response to a pipelined command, err is the error reported by the server
+type pipelined struct {
+	line string
+	err  error
+}
+
+// errPipelineOrder - the server answered the pipelined commands out of order or with an unexpected response
+var errPipelineOrder = errors.New("unexpected response to a pipelined command")
+
+// pipeline writes the commands at once and reads their responses in order, saving a round trip per command.
+// A response not matching its command, or a failed read, leaves the rest of the responses unmatched,
+// the connection is then closed and reopened by the next command.
+func (c *connection) pipeline(cmds []pipelineCommand) ([]pipelined, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.reopen(); err != nil {
+		return nil, err
+	}
+
+	if c.pending != nil {
+		if err := c.drain(); err != nil {
+			return nil, err
+		}
+	}
+
+	var b strings.Builder
+	for _, cmd := range cmds {
+		b.WriteString(cmd.cmd)
+		b.WriteString("\n")
+	}
+	c.client.stats.commands.Add(int64(len(cmds)))
+	n, err := io.WriteString(c.conn, b.String())
+	c.client.stats.sent.Add(int64(n))
+	if err != nil {
+		c.client.stats.errors.Add(1)
+		c.abandon()
+		return nil, fmt.Errorf("failed to send commands: %s", err)
+	}
+
+	results := make([]pipelined, 0, len(cmds))
+	for _, cmd := range cmds {
+		err := c.readLines("", false, func(line string) error {
+			switch {
+			case strings.HasPrefix(line, "ERR "):
+				c.client.stats.errors.Add(1)
+				results = append(results, pipelined{err: &Error{Code: strings.Split(line, " ")[1]}})
+			case strings.HasPrefix(line, cmd.prefix):
+				results = append(results, pipelined{line: line})
+			default:
+				return fmt.Errorf("%w: %q to %q", errPipelineOrder, line, cmd.cmd)
+			}
+			return nil
+		})
+		if err != nil {
+			c.client.stats.errors.Add(1)
+			// the responses of the rest of the commands can't be told apart anymore
+			c.abandon()
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// drain reads the rest of the timed out response, so it's not read as the response to the next command
+func (c *connection) drain() error {
+	pending := c.pending
+	if err := c.readLines(pending.endLine, pending.multiLine, func(string) error { return nil }); err != nil {
+		// still no response, the next command tries again unless the connection was abandoned
+		if !c.broken {
+			c.pending = pending
+		}
+		return fmt.Errorf("waiting for timed out response: %w", err)
+	}
+	c.pending = nil
+	log.Printf("[DEBUG] drained a timed out response from %s:%s", c.client.hostname, c.client.port)
+	return nil
+}
+
+// errResponseTooLarge is returned for a response over the max size or number of lines. The rest of the response
+// is left unread, the connection is closed and reopened by the next command.
+var errResponseTooLarge = errors.New("response too large")
+
+// exceedsLimit reports whether the response was over a limit, sending the command again gets the same response
+func exceedsLimit(err error) bool {
+	return errors.Is(err, errResponseTooLarge) || errors.Is(err, errLineTooLong)
+}
+
+// readLines reads the response from the NUT server and calls fn with each line until the end line,
+// reading stops at the first error of fn. The response limits are checked while reading.
+func (c *connection) readLines(endLine string, multiLineResponse bool, fn func(line string) error) error {
+	timeout := c.client.poll.Timeout
+	if timeout <= 0 {
+		// a client not made by New, e.g. the probe of Discover
+		timeout = defaultPollTimeout
+	}
+	_ = c.conn.SetReadDeadline(time.Now().Add(timeout))
+	endLine = strings.TrimRight(endLine, "\r\n")
+	lines, size := 0, 0
+
+	// the reader is kept on the connection, so data buffered past the end of one
+	// response is not lost for the next one
+	for {
+		line, err := c.readLine()
+		c.client.stats.received.Add(int64(len(line)))
+		if err != nil {
+			if isTimeout(err) {
+				c.pending = &pendingResponse{endLine: endLine, multiLine: multiLineResponse}
+			}
+			if errors.Is(err, errLineTooLong) {
+				c.abandon()
+			}
+			return fmt.Errorf("error reading response: %w", err)
+		}
+		size += len(line)
+		if size > c.client.maxResponseSize {
+			c.abandon()
+			return fmt.Errorf("%w: exceeds %d bytes", errResponseTooLarge, c.client.maxResponseSize)
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		lines++
+		if lines > c.client.maxResponseLines {
+			c.abandon()
+			return fmt.Errorf("%w: exceeds %d lines", errResponseTooLarge, c.client.maxResponseLines)
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+		if line == endLine || !multiLineResponse {
+			return nil
+		}
+	}
+}
+
+// minReaderSize and maxReaderSize bound the buffer of the connection reader, a longer line is read in chunks
+const (
+	minReaderSize = 4096
+	maxReaderSize = 64 << 10
+)
+
+// errLineTooLong is returned for a response line over the max line length, the rest of the line
+// is left unread, the connection is closed and reopened by the next command
+var errLineTooLong = errors.New("response line too long")
+
+// newReader returns the reader of the connection with the buffer fitting a line of the max length
+func newReader(conn net.Conn, maxLineLength int) *bufio.Reader {
+	return bufio.NewReaderSize(conn, min(max(maxLineLength, minReaderSize), maxReaderSize))
+}
+
+// readLine reads a line of the response with the line end, at most maxLineLength bytes. A longer line
+// fails with errLineTooLong without buffering it whole. The partial line is returned with a read error.
+func (c *connection) readLine() (string, error) {
+	var line []byte
+	for {
+		chunk, err := c.reader.ReadSlice('\n')
+		if len(line)+len(chunk) > c.client.maxLineLength {
+			c.client.stats.received.Add(int64(len(line) + len(chunk)))
+			return "", fmt.Errorf("%w: exceeds %d bytes", errLineTooLong, c.client.maxLineLength)
+		}
+		line = append(line, chunk...)
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		return string(line), err
+	}
+}
+
+// authenticate the existing NUT session with provided username and password.
+func (c *connection) authenticate(username, password string) (bool, error) {
+	resp, err := c.send(fmt.Sprintf("USERNAME %s", username))
+	if err != nil {
+		return false, fmt.Errorf("failed to send USERNAME command: %w", err)
+	}
+	if len(resp) == 0 || resp[0] != "OK" {
+		return false, fmt.Errorf("invalid response to USERNAME: %q", resp)
+	}
+
+	resp, err = c.send(fmt.Sprintf("PASSWORD %s", password))
+	if err != nil {
+		return false, fmt.Errorf("failed to send PASSWORD command: %w", err)
+	}
+	if len(resp) == 0 || resp[0] != "OK" {
+		return false, fmt.Errorf("invalid response to PASSWORD: %q", resp)
+	}
+
+	return true, nil
+}
+
+// getVersion reads the version of the server currently in use.
+// getNetworkProtocolVersion reads the version of the network protocol currently in use.
+func (c *connection) getVersion() error {
+	resp, err := c.send("VER")
+	if err != nil {
+		return fmt.Errorf("failed to get version: %s", err)
+	}
+	if len(resp) < 1 {
+		return fmt.Errorf("empty response to VER")
+	}
+	c.versionBanner = banner(resp)
+	version, ok := parseServerVersion(resp)
+	if !ok {
+		log.Printf("[WARN] no version number in the response to VER of %s:%s: %q", c.client.hostname, c.client.port, c.versionBanner)
+		version = c.versionBanner
+	}
+	c.version = version
+	return nil
+}
+func (c *connection) getNetworkProtocolVersion() error {
+	resp, err := c.send("NETVER")
+	if err != nil {
+		return fmt.Errorf("failed to get network protocol version: %s", err)
+	}
+	if len(resp) < 1 {
+		return fmt.Errorf("empty response to NETVER")
+	}
+	c.protocolBanner = banner(resp)
+	version, ok := parseProtocolVersion(resp)
+	if !ok {
+		log.Printf("[WARN] no version number in the response to NETVER of %s:%s: %q", c.client.hostname, c.client.port, c.protocolBanner)
+		version = c.protocolBanner
+	}
+	c.protocolVersion = version
+	return nil
+}
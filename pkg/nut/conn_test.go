@@ -0,0 +1,233 @@
+package nut
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// dropOnce closes the connection on the first command with the prefix, the server may have executed it
+func dropOnce(prefix string) func(line string) ([]string, bool) {
+	var dropped atomic.Bool
+	return func(line string) ([]string, bool) {
+		if strings.HasPrefix(line, prefix) && dropped.CompareAndSwap(false, true) {
+			return nil, true
+		}
+		return nil, false
+	}
+}
+
+// count returns how many of the commands start with the prefix
+func count(commands []string, prefix string) int {
+	n := 0
+	for _, cmd := range commands {
+		if strings.HasPrefix(cmd, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestRetryable(t *testing.T) {
+	for cmd, want := range map[string]bool{
+		"GET VAR ups battery.charge": true,
+		"LIST VAR ups":               true,
+		"VER":                        true,
+		"NETVER":                     true,
+		"INSTCMD ups load.off":       false,
+		`SET VAR ups ups.id "rack"`:  false,
+		"FSD ups":                    false,
+		"PRIMARY ups":                false,
+		"LOGOUT":                     false,
+		"GETTER ups":                 false,
+		"LISTEN ups battery.charge":  false,
+	} {
+		if got := retryable(cmd); got != want {
+			t.Errorf("retryable(%q) = %v, want %v", cmd, got, want)
+		}
+	}
+}
+
+func TestCommandsRetriedAfterReconnect(t *testing.T) {
+	for _, mode := range []string{ConnectionShared, ConnectionPool} {
+		t.Run(mode, func(t *testing.T) {
+			device := writeableDevice()
+			device.Cmds = []string{"load.off"}
+			server := newFakeUPSD(t, device)
+			ups := server.ups(t, server.client(t, Config{ConnectionMode: mode, ConnectionPoolSize: 2}), "ups")
+
+			server.setHandler(dropOnce("GET VAR "))
+			if _, err := ups.GetVariableValue("ups.status"); err != nil {
+				t.Errorf("GET VAR not retried: %v", err)
+			}
+			if n := count(server.commands(), "GET VAR ups ups.status"); n != 2 {
+				t.Errorf("GET VAR sent %d times, want 2", n)
+			}
+
+			server.setHandler(dropOnce("INSTCMD "))
+			if _, err := ups.SendCommand("load.off"); err == nil {
+				t.Error("INSTCMD succeeded after the connection failed")
+			}
+			if n := count(server.commands(), "INSTCMD "); n != 1 {
+				t.Errorf("INSTCMD sent %d times, want 1", n)
+			}
+			// the failed connection is reopened by the next command, even one that isn't retried
+			if _, err := ups.SendCommand("load.off"); err != nil {
+				t.Errorf("INSTCMD after the failed INSTCMD: %v", err)
+			}
+			if _, err := ups.GetVariableValue("ups.status"); err != nil {
+				t.Errorf("GET VAR after the failed INSTCMD: %v", err)
+			}
+
+			server.setHandler(dropOnce("SET VAR "))
+			if _, err := ups.SetVariable("ups.id", "rack 2", false); err == nil {
+				t.Error("SET VAR succeeded after the connection failed")
+			}
+			if n := count(server.commands(), "SET VAR "); n != 1 {
+				t.Errorf("SET VAR sent %d times, want 1", n)
+			}
+		})
+	}
+}
+
+func TestOversizedResponseReconnects(t *testing.T) {
+	for _, mode := range []string{ConnectionShared, ConnectionPerUPS} {
+		t.Run(mode, func(t *testing.T) {
+			server := newFakeUPSD(t, writeableDevice())
+			ups := server.ups(t, server.client(t, Config{ConnectionMode: mode, MaxResponseLines: 10}), "ups")
+
+			server.setHandler(func(line string) ([]string, bool) {
+				if line != "LIST VAR ups" {
+					return nil, false
+				}
+				resp := []string{"BEGIN LIST VAR ups"}
+				for i := range 20 {
+					resp = append(resp, fmt.Sprintf(`VAR ups extra.%d "%d"`, i, i))
+				}
+				return append(resp, "END LIST VAR ups"), true
+			})
+			sent := count(server.commands(), "LIST VAR ups")
+			if err := ups.streamCommand("LIST VAR ups", func(string) {}); !errors.Is(err, errResponseTooLarge) {
+				t.Fatalf("LIST VAR error = %v, want %v", err, errResponseTooLarge)
+			}
+			if n := count(server.commands(), "LIST VAR ups") - sent; n != 1 {
+				t.Errorf("oversized LIST VAR sent %d times, want 1", n)
+			}
+
+			// the rest of the oversized response must not be read as the response to the next command
+			value, err := ups.GetVariableValue("ups.status")
+			if err != nil || value != "OL" {
+				t.Errorf("GET VAR after the oversized response = %v, %v, want OL", value, err)
+			}
+		})
+	}
+}
+
+func TestLongLineReconnects(t *testing.T) {
+	for _, mode := range []string{ConnectionShared, ConnectionPerUPS} {
+		t.Run(mode, func(t *testing.T) {
+			device := writeableDevice()
+			device.Cmds = []string{"load.off"}
+			server := newFakeUPSD(t, device)
+			ups := server.ups(t, server.client(t, Config{ConnectionMode: mode, MaxLineLength: 100}), "ups")
+
+			server.setHandler(func(line string) ([]string, bool) {
+				if strings.HasPrefix(line, "INSTCMD ") {
+					// longer than the reader buffer, the end of the line stays unread
+					return []string{"OK " + strings.Repeat("x", 2*minReaderSize)}, true
+				}
+				return nil, false
+			})
+			if _, err := ups.SendCommand("load.off"); !errors.Is(err, errLineTooLong) {
+				t.Fatalf("INSTCMD error = %v, want %v", err, errLineTooLong)
+			}
+			if n := count(server.commands(), "INSTCMD "); n != 1 {
+				t.Errorf("INSTCMD sent %d times, want 1", n)
+			}
+
+			// the rest of the long line must not be read as the response to the next command
+			value, err := ups.GetVariableValue("ups.status")
+			if err != nil || value != "OL" {
+				t.Errorf("GET VAR after the long line = %v, %v, want OL", value, err)
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	tests := []struct {
+		name     string
+		response []string
+		err      bool
+	}{
+		{name: "OK Goodbye", response: []string{"OK Goodbye"}},
+		{name: "Goodbye", response: []string{"Goodbye..."}},
+		{name: "silent close", response: nil},
+		{name: "error", response: []string{"ERR UNKNOWN-COMMAND"}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeUPSD(t, writeableDevice())
+			client := server.client(t, Config{})
+			server.setHandler(func(line string) ([]string, bool) {
+				if line == "LOGOUT" {
+					return tt.response, true
+				}
+				return nil, false
+			})
+
+			if err := client.Disconnect(); (err != nil) != tt.err {
+				t.Errorf("Disconnect error = %v, want error %v", err, tt.err)
+			}
+			if n := count(server.commands(), "LOGOUT"); n != 1 {
+				t.Errorf("LOGOUT sent %d times, want 1", n)
+			}
+		})
+	}
+}
+
+func TestReadLine(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxLineLength int
+		length        int
+		err           bool
+	}{
+		{name: "short", maxLineLength: 100, length: 10},
+		{name: "at the limit", maxLineLength: 100, length: 100},
+		{name: "one byte over", maxLineLength: 100, length: 101, err: true},
+		// the buffer is at most maxReaderSize, a longer line is read in chunks
+		{name: "longer than the buffer", maxLineLength: 3 * maxReaderSize, length: 2*maxReaderSize + 10},
+		{name: "longer than the buffer at the limit", maxLineLength: 3 * maxReaderSize, length: 3 * maxReaderSize},
+		{name: "longer than the buffer one byte over", maxLineLength: 3 * maxReaderSize, length: 3*maxReaderSize + 1, err: true},
+		{name: "over the limit and the buffer", maxLineLength: 100, length: 2 * minReaderSize, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the length includes the line end
+			line := strings.Repeat("x", tt.length-1) + "\n"
+			c := &connection{client: &Client{maxLineLength: tt.maxLineLength}}
+			c.reader = bufio.NewReaderSize(strings.NewReader(line+"OK\n"), min(max(tt.maxLineLength, minReaderSize), maxReaderSize))
+
+			got, err := c.readLine()
+			if tt.err {
+				if !errors.Is(err, errLineTooLong) {
+					t.Fatalf("readLine error = %v, want %v", err, errLineTooLong)
+				}
+				if received := c.client.stats.received.Load(); received < int64(tt.maxLineLength) {
+					t.Errorf("%d bytes counted as received, want at least %d", received, tt.maxLineLength)
+				}
+				return
+			}
+			if err != nil || got != line {
+				t.Fatalf("readLine = %d bytes, %v, want %d", len(got), err, len(line))
+			}
+			if next, err := c.readLine(); err != nil || next != "OK\n" {
+				t.Errorf("next line = %q, %v, want OK", next, err)
+			}
+		})
+	}
+}
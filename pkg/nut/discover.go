@@ -0,0 +1,142 @@
+package nut
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+)
+
+// upsdPort - default port of upsd
+const upsdPort = "3493"
+
+// maxDiscoverHosts limits the scanned subnet to a /16
+const maxDiscoverHosts = 1 << 16
+
+// Found - NUT server found by Discover
+type Found struct {
+	Address string
+	Version string
+	UPSs    []FoundUPS
+	// Err is set when the port is open but LIST UPS failed, e.g. the server requires a login
+	Err error
+}
+
+// FoundUPS - UPS listed by the found server
+type FoundUPS struct {
+	Name        string
+	Description string
+}
+
+// Discover scans the subnet for open upsd ports and lists the UPSs of each server anonymously.
+// At most concurrency hosts are dialed at once, each with the timeout. The servers are only listed,
+// nothing is monitored.
+func Discover(ctx context.Context, cidr string, concurrency int, timeout time.Duration) ([]Found, error) {
+	return discover(ctx, cidr, upsdPort, concurrency, timeout)
+}
+
+// discover scans the subnet like Discover, dialing the port on each host
+func discover(ctx context.Context, cidr, port string, concurrency int, timeout time.Duration) ([]Found, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subnet %q: %w", cidr, err)
+	}
+	prefix = prefix.Masked()
+	if bits := prefix.Addr().BitLen() - prefix.Bits(); bits > 16 {
+		return nil, fmt.Errorf("subnet %s is too large, at most %d addresses are scanned", prefix, maxDiscoverHosts)
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var (
+		found []Found
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+	)
+	slots := make(chan struct{}, concurrency)
+	for addr := prefix.Addr(); prefix.Contains(addr); addr = addr.Next() {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return found, ctx.Err()
+		}
+		wg.Add(1)
+		go func(addr netip.Addr) {
+			defer func() { <-slots; wg.Done() }()
+			f, ok := probe(ctx, net.JoinHostPort(addr.String(), port), timeout)
+			if !ok {
+				return
+			}
+			mu.Lock()
+			found = append(found, f)
+			mu.Unlock()
+		}(addr)
+	}
+	wg.Wait()
+
+	sort.Slice(found, func(i, j int) bool {
+		a, _ := netip.ParseAddrPort(found[i].Address)
+		b, _ := netip.ParseAddrPort(found[j].Address)
+		return a.Compare(b) < 0
+	})
+	return found, nil
+}
+
+// probe reports whether upsd listens on the address, and lists its UPSs without logging in.
+// The timeout bounds the dial and the read of each response.
+func probe(ctx context.Context, address string, timeout time.Duration) (Found, bool) {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return Found{}, false
+	}
+	defer conn.Close()
+
+	// a throwaway connection, only for the response parsing
+	c := &connection{
+		client: &Client{
+			poll:             PollConfig{Timeout: timeout},
+			maxResponseLines: defaultMaxResponseLines,
+			maxResponseSize:  defaultMaxResponseSize,
+			maxLineLength:    defaultMaxLineLength,
+		},
+		conn:   conn,
+		reader: newReader(conn, defaultMaxLineLength),
+	}
+	found := Found{Address: address}
+
+	// any response, even ERR, tells it's upsd
+	if resp, err := c.send("VER"); err == nil && len(resp) > 0 {
+		found.Version = banner(resp)
+		if version, ok := parseServerVersion(resp); ok {
+			found.Version = version
+		}
+	} else if !isServerError(err) {
+		return Found{}, false
+	}
+
+	resp, err := c.send("LIST UPS")
+	if err != nil {
+		found.Err = err
+		_, _ = c.send("LOGOUT")
+		return found, true
+	}
+	for _, line := range listBody(resp) {
+		fields, err := splitFields(line)
+		if err != nil || len(fields) < 2 || fields[0] != "UPS" {
+			continue
+		}
+		ups := FoundUPS{Name: fields[1]}
+		if len(fields) > 2 {
+			ups.Description = fields[2]
+		}
+		found.UPSs = append(found.UPSs, ups)
+	}
+	_, _ = c.send("LOGOUT")
+	return found, true
+}
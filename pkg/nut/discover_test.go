@@ -0,0 +1,59 @@
+package nut
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDiscover(t *testing.T) {
+	server := newFakeUPSD(t, writeableDevice())
+	_, port, _ := net.SplitHostPort(server.listener.Addr().String())
+
+	found, err := discover(context.Background(), "127.0.0.1/32", port, 1, time.Second)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if len(found) != 1 {
+		t.Fatalf("found %d servers, want 1: %+v", len(found), found)
+	}
+	f := found[0]
+	if f.Address != server.listener.Addr().String() || f.Version != "2.8.1" || f.Err != nil {
+		t.Errorf("found %+v, want the fake upsd 2.8.1", f)
+	}
+	if len(f.UPSs) != 1 || f.UPSs[0].Name != "ups" || f.UPSs[0].Description != "Test UPS" {
+		t.Errorf("UPSs = %+v, want ups", f.UPSs)
+	}
+}
+
+func TestDiscoverSilentHost(t *testing.T) {
+	// the port is open, but nothing is ever answered
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// closed by the probe, the server only never writes
+			go func() { _, _ = io.Copy(io.Discard, conn); _ = conn.Close() }()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	start := time.Now()
+	found, err := discover(context.Background(), "127.0.0.1/32", port, 1, 100*time.Millisecond)
+	if err != nil || len(found) != 0 {
+		t.Errorf("discover = %+v, %v, want nothing found", found, err)
+	}
+	// the reads are bounded by the timeout of the probe, not by the default poll timeout
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("discover took %s with the timeout of 100ms", elapsed)
+	}
+}
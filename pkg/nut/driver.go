@@ -0,0 +1,46 @@
+package nut
+
+import (
+	"strings"
+)
+
+// Driver - NUT driver serving the UPS, from the driver.* variables
+type Driver struct {
+	Name            string
+	Version         string
+	VersionInternal string
+	// State is the state of the driver, e.g. quiet or reconnect.trying, empty for drivers older than NUT 2.8
+	State      string
+	Parameters map[string]string
+}
+
+// Healthy reports whether the driver is running normally. The driver is reported
+// as healthy when it doesn't export its state.
+func (d Driver) Healthy() bool {
+	switch d.State {
+	case "", "quiet", "dumping":
+		return true
+	}
+	return false
+}
+
+// GetDriver returns the driver diagnostics of the UPS. The raw values are used,
+// e.g. a version like 2.8 is not a number.
+func (u *UPS) GetDriver() Driver {
+	driver := Driver{Parameters: make(map[string]string)}
+	for _, variable := range u.LastVariables() {
+		switch name := variable.Name; {
+		case name == "driver.name":
+			driver.Name = variable.Raw
+		case name == "driver.version":
+			driver.Version = variable.Raw
+		case name == "driver.version.internal":
+			driver.VersionInternal = variable.Raw
+		case name == "driver.state":
+			driver.State = variable.Raw
+		case strings.HasPrefix(name, "driver.parameter."):
+			driver.Parameters[strings.TrimPrefix(name, "driver.parameter.")] = variable.Raw
+		}
+	}
+	return driver
+}
@@ -0,0 +1,57 @@
+package nut
+
+import (
+	"fmt"
+)
+
+// GetCurrent returns the output current in amperes, as reported by output.current
+func (u *UPS) GetCurrent() (float64, error) {
+	if value, ok := u.FloatVar("output.current"); ok {
+		return value, nil
+	}
+	return 0, fmt.Errorf("output.current variable not found")
+}
+
+// GetApparentPower returns the apparent power of the load in VA, as reported by ups.power,
+// or computed from output.voltage and output.current
+func (u *UPS) GetApparentPower() (float64, error) {
+	if value, ok := u.FloatVar("ups.power"); ok {
+		return value, nil
+	}
+	voltage, voltageOK := u.FloatVar("output.voltage")
+	current, currentOK := u.FloatVar("output.current")
+	if voltageOK && currentOK {
+		return voltage * current, nil
+	}
+	return 0, fmt.Errorf("ups.power variable not found")
+}
+
+// GetPowerFactor returns the output power factor between 0 and 1, as reported by output.powerfactor.
+// Some drivers report it in percent, values above 1 are scaled down.
+func (u *UPS) GetPowerFactor() (float64, error) {
+	value, ok := u.FloatVar("output.powerfactor")
+	if !ok || value < 0 {
+		return 0, fmt.Errorf("output.powerfactor variable not found")
+	}
+	if value > 1 {
+		value /= 100
+	}
+	return value, nil
+}
+
+// measuredPower returns the real power of the load in watts, reported by ups.realpower or computed from
+// the apparent power and the power factor, false when the UPS reports neither
+func (u *UPS) measuredPower() (int64, bool) {
+	if value, ok := u.IntVar("ups.realpower"); ok {
+		return value, true
+	}
+	apparent, err := u.GetApparentPower()
+	if err != nil {
+		return 0, false
+	}
+	factor, err := u.GetPowerFactor()
+	if err != nil {
+		return 0, false
+	}
+	return int64(apparent*factor + 0.5), true
+}
@@ -0,0 +1,60 @@
+package nut
+
+import (
+	"fmt"
+	"time"
+)
+
+// Energy - the energy delivered to the load since Since, estimated from the power reported by the polls
+type Energy struct {
+	Since time.Time
+	// KWh is the sum of the power between consecutive successful polls, the time across failed polls is not counted
+	KWh float64
+	// Measured is false when the power is estimated from ups.load and the nominal power
+	Measured bool
+}
+
+// GetEfficiency returns the efficiency of the UPS in percent, as reported by ups.efficiency
+func (u *UPS) GetEfficiency() (float64, error) {
+	if value, ok := u.FloatVar("ups.efficiency"); ok {
+		return value, nil
+	}
+	return 0, fmt.Errorf("ups.efficiency variable not found")
+}
+
+// GetEnergy returns the energy estimated since the first poll, ok is false when the UPS doesn't report the power
+func (u *UPS) GetEnergy() (Energy, bool) {
+	u.energyMu.Lock()
+	defer u.energyMu.Unlock()
+	return u.energy, !u.energy.Since.IsZero()
+}
+
+// integrateEnergy adds the energy since the previous poll, averaging its power with the current one.
+// A failed poll resets the previous sample, the energy is not integrated across the gap.
+func (u *UPS) integrateEnergy(failed bool) {
+	u.energyMu.Lock()
+	defer u.energyMu.Unlock()
+
+	now := time.Now()
+	if failed {
+		u.energySample = time.Time{}
+		return
+	}
+	_, power, _ := u.GetLoad()
+	_, measured := u.measuredPower()
+	if power <= 0 && !measured {
+		u.energySample = time.Time{}
+		return
+	}
+
+	if u.energy.Since.IsZero() {
+		u.energy.Since = now
+	}
+	if !u.energySample.IsZero() {
+		hours := now.Sub(u.energySample).Hours()
+		u.energy.KWh += (u.energyPower + float64(power)) / 2 * hours / 1000
+	}
+	u.energy.Measured = measured
+	u.energySample = now
+	u.energyPower = float64(power)
+}
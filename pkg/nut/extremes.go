@@ -0,0 +1,79 @@
+package nut
+
+import (
+	"time"
+)
+
+// Extreme - the highest or lowest value of a metric and the time it was observed
+type Extreme struct {
+	Value float64
+	Time  time.Time
+}
+
+// Observed reports whether the metric was reported by the UPS since the tracking started
+func (e Extreme) Observed() bool {
+	return !e.Time.IsZero()
+}
+
+// Extremes - the extremes of the UPS metrics observed since Since, the start of nutshell or the last reset
+type Extremes struct {
+	Since          time.Time
+	PeakLoad       Extreme
+	PeakPower      Extreme
+	MinRuntime     Extreme
+	MinCharge      Extreme
+	MaxTemperature Extreme
+}
+
+// GetExtremes returns the extremes observed by the polls of the UPS
+func (u *UPS) GetExtremes() Extremes {
+	u.extremesMu.Lock()
+	defer u.extremesMu.Unlock()
+	return u.extremes
+}
+
+// ResetExtremes clears the observed extremes, the tracking starts again from the next poll
+func (u *UPS) ResetExtremes() {
+	u.extremesMu.Lock()
+	defer u.extremesMu.Unlock()
+	u.extremes = Extremes{Since: time.Now()}
+}
+
+// trackExtremes updates the extremes with the values of the last successful poll, metrics not reported by the UPS are skipped
+func (u *UPS) trackExtremes() {
+	u.extremesMu.Lock()
+	defer u.extremesMu.Unlock()
+
+	now := time.Now()
+	if u.extremes.Since.IsZero() {
+		u.extremes.Since = now
+	}
+	higher := func(e *Extreme, value float64) {
+		if !e.Observed() || value > e.Value {
+			*e = Extreme{Value: value, Time: now}
+		}
+	}
+	lower := func(e *Extreme, value float64) {
+		if !e.Observed() || value < e.Value {
+			*e = Extreme{Value: value, Time: now}
+		}
+	}
+
+	if load, ok := u.IntVar("ups.load"); ok {
+		higher(&u.extremes.PeakLoad, float64(load))
+	}
+	if _, power, _ := u.GetLoad(); power > 0 {
+		higher(&u.extremes.PeakPower, float64(power))
+	}
+	if runtime, ok := u.IntVar("battery.runtime"); ok {
+		lower(&u.extremes.MinRuntime, float64(runtime))
+	}
+	if charge, ok := u.IntVar("battery.charge"); ok {
+		lower(&u.extremes.MinCharge, float64(charge))
+	}
+	if temperature, ok := u.FloatVar("ups.temperature"); ok {
+		higher(&u.extremes.MaxTemperature, temperature)
+	} else if temperature, ok := u.FloatVar("battery.temperature"); ok {
+		higher(&u.extremes.MaxTemperature, temperature)
+	}
+}
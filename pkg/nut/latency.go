@@ -0,0 +1,88 @@
+package nut
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// latencyWindow is the number of the recent successful polls the latency is computed from,
+// latencyMinSamples is the number of polls needed before a UPS is reported slow
+const (
+	latencyWindow     = 20
+	latencyMinSamples = 5
+)
+
+// PollLatency - the durations of the recent successful polls of the UPS
+type PollLatency struct {
+	P50       time.Duration
+	P95       time.Duration
+	Max       time.Duration
+	Samples   int
+	Threshold time.Duration
+	// Slow reports the 95th percentile over the threshold, the server responds slowly
+	Slow bool
+}
+
+// latency is the ring of the recent poll durations
+type latency struct {
+	durations []time.Duration
+	next      int
+	mu        sync.Mutex
+}
+
+func (l *latency) add(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.durations) < latencyWindow {
+		l.durations = append(l.durations, d)
+		return
+	}
+	l.durations[l.next] = d
+	l.next = (l.next + 1) % latencyWindow
+}
+
+// sorted returns a sorted copy of the durations
+func (l *latency) sorted() []time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := slices.Clone(l.durations)
+	slices.Sort(list)
+	return list
+}
+
+// percentile returns the nearest-rank percentile of the sorted durations
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// GetPollLatency returns the durations of the recent successful polls, Slow is set when the 95th percentile
+// exceeds SlowPollThreshold over at least latencyMinSamples polls
+func (u *UPS) GetPollLatency() PollLatency {
+	sorted := u.latency.sorted()
+	l := PollLatency{
+		P50:     percentile(sorted, 50),
+		P95:     percentile(sorted, 95),
+		Samples: len(sorted),
+	}
+	if len(sorted) > 0 {
+		l.Max = sorted[len(sorted)-1]
+	}
+	if u.Client != nil {
+		l.Threshold = u.Client.slowPollThreshold
+	}
+	l.Slow = l.Threshold > 0 && l.Samples >= latencyMinSamples && l.P95 > l.Threshold
+	return l
+}
+
+// SlowResponses reports whether the recent polls of the UPS exceed the slow poll threshold
+func (u *UPS) SlowResponses() bool {
+	return !u.gone.Load() && u.GetPollLatency().Slow
+}
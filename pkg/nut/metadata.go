@@ -0,0 +1,180 @@
+package nut
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// variableMeta - description and type of the variable, cached between polls
+type variableMeta struct {
+	description   string
+	varType       string
+	writeable     bool
+	maximumLength int
+}
+
+// metadataExpired reports whether the metadata of variables must be read again in this poll.
+// A firmware or driver update may change the types of variables or add writeable ones.
+func (u *UPS) metadataExpired() bool {
+	u.metaMu.Lock()
+	defer u.metaMu.Unlock()
+	return u.meta == nil || time.Since(u.metaUpdated) >= u.Client.metadataRefresh
+}
+
+// metadata returns the cached metadata of the variable, the metadata is read from the server when
+// it's not cached yet or refresh is requested. Changes of the cached metadata are logged.
+// Only connection failures are returned, the metadata rejected by the server is cached empty.
+func (u *UPS) metadata(name string, refresh bool) (variableMeta, error) {
+	u.metaMu.Lock()
+	cached, ok := u.meta[name]
+	u.metaMu.Unlock()
+	if ok && !refresh {
+		return cached, nil
+	}
+
+	var resp metaResponse
+	resp.description, resp.descriptionErr = u.GetVariableDescription(name)
+	if resp.descriptionErr != nil && !isServerError(resp.descriptionErr) {
+		return variableMeta{}, resp.descriptionErr
+	}
+	resp.varType, resp.writeable, resp.maximumLength, resp.typeErr = u.GetVariableType(name)
+	return u.storeMetadata(name, resp)
+}
+
+// metaResponse - the responses to GET DESC and GET TYPE of a variable
+type metaResponse struct {
+	description    string
+	descriptionErr error
+	varType        string
+	writeable      bool
+	maximumLength  int
+	typeErr        error
+}
+
+// storeMetadata caches the metadata read from the server and logs the changes
+func (u *UPS) storeMetadata(name string, resp metaResponse) (variableMeta, error) {
+	// a server without GET DESC or GET TYPE for the variable doesn't fail the poll, the type is inferred from the value
+	if err := resp.descriptionErr; err != nil {
+		if !isServerError(err) {
+			return variableMeta{}, err
+		}
+		log.Printf("[WARN] %s: no description of %s: %v", u.Name, name, err)
+	}
+	if err := resp.typeErr; err != nil {
+		if !isServerError(err) {
+			return variableMeta{}, err
+		}
+		log.Printf("[WARN] %s: no type of %s, inferred from the value: %v", u.Name, name, err)
+		resp.varType, resp.writeable, resp.maximumLength = "UNKNOWN", false, 0
+	}
+	meta := variableMeta{
+		description:   resp.description,
+		varType:       resp.varType,
+		writeable:     resp.writeable,
+		maximumLength: resp.maximumLength,
+	}
+
+	u.metaMu.Lock()
+	defer u.metaMu.Unlock()
+	if u.meta == nil {
+		u.meta = make(map[string]variableMeta)
+	}
+	cached, ok := u.meta[name]
+	switch {
+	case u.metaUpdated.IsZero():
+		// nothing to compare with before the first full read
+	case !ok:
+		log.Printf("[INFO] %s: new variable %s (%s, writeable=%t)", u.Name, name, meta.varType, meta.writeable)
+	case cached != meta:
+		log.Printf("[INFO] %s: metadata of %s changed from %+v to %+v", u.Name, name, cached, meta)
+	}
+	u.meta[name] = meta
+
+	return meta, nil
+}
+
+// pipelineBatch is the number of variables, two commands each, whose metadata is requested at once in the pipelined mode
+const pipelineBatch = 32
+
+// prefetchMetadata reads the metadata of the variables not cached, or all with refresh, with the commands pipelined
+// in batches instead of a round trip per command. It reports whether the metadata was read, false when pipelining
+// is disabled or the server doesn't answer the pipelined commands in order, the variables are then read one by one.
+func (u *UPS) prefetchMetadata(names []string, refresh bool) (bool, error) {
+	if !u.Client.pipeline || u.Client.pipelineBroken.Load() {
+		return false, nil
+	}
+
+	var missing []string
+	u.metaMu.Lock()
+	for _, name := range names {
+		if _, ok := u.meta[name]; refresh || !ok {
+			missing = append(missing, name)
+		}
+	}
+	u.metaMu.Unlock()
+
+	for start := 0; start < len(missing); start += pipelineBatch {
+		batch := missing[start:min(start+pipelineBatch, len(missing))]
+		cmds := make([]pipelineCommand, 0, 2*len(batch))
+		for _, name := range batch {
+			cmds = append(cmds,
+				pipelineCommand{cmd: fmt.Sprintf("GET DESC %s %s", u.Name, name), prefix: fmt.Sprintf("DESC %s %s ", u.Name, name)},
+				pipelineCommand{cmd: fmt.Sprintf("GET TYPE %s %s", u.Name, name), prefix: fmt.Sprintf("TYPE %s %s ", u.Name, name)},
+			)
+		}
+
+		var results []pipelined
+		err := u.withConnection(func(conn *connection) error {
+			var err error
+			results, err = conn.pipeline(cmds)
+			return err
+		})
+		if errors.Is(err, errPipelineOrder) {
+			if !u.Client.pipelineBroken.Swap(true) {
+				log.Printf("[WARN] %s:%s doesn't answer pipelined commands in order, pipelining disabled: %v", u.Client.hostname, u.Client.port, err)
+			}
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to read metadata: %w", err)
+		}
+
+		for i, name := range batch {
+			var resp metaResponse
+			if desc := results[2*i]; desc.err != nil {
+				resp.descriptionErr = desc.err
+			} else {
+				resp.description, resp.descriptionErr = parseDescription(desc.line)
+			}
+			if typ := results[2*i+1]; typ.err != nil {
+				resp.varType, resp.typeErr = "UNKNOWN", typ.err
+			} else {
+				resp.varType, resp.writeable, resp.maximumLength, resp.typeErr = u.parseType(name, typ.line)
+			}
+			if _, err := u.storeMetadata(name, resp); err != nil {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// metadataRefreshed marks the metadata as fresh after all variables were read, and forgets the removed variables
+func (u *UPS) metadataRefreshed(names []string) {
+	u.metaMu.Lock()
+	defer u.metaMu.Unlock()
+
+	present := make(map[string]bool, len(names))
+	for _, name := range names {
+		present[name] = true
+	}
+	for name := range u.meta {
+		if !present[name] {
+			log.Printf("[INFO] %s: variable %s removed", u.Name, name)
+			delete(u.meta, name)
+		}
+	}
+	u.metaUpdated = time.Now()
+}
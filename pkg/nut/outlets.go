@@ -0,0 +1,83 @@
+package nut
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// outletVariable matches the variables of outlets and outlet groups, e.g. outlet.1.status or outlet.group.2.desc
+var outletVariable = regexp.MustCompile(`^(outlet(?:\.group)?)\.(\d+)\.(.+)$`)
+
+// Outlet - switchable outlet or outlet group of a managed UPS
+type Outlet struct {
+	// Prefix of the outlet variables and commands, e.g. outlet.1
+	Prefix      string
+	Description string
+	Status      string
+	Switchable  bool
+	Power       int64
+	Current     float64
+}
+
+// GetOutlets returns the outlets and outlet groups of the UPS, sorted by their number.
+// UPSs without outlets return none.
+func (u *UPS) GetOutlets() []Outlet {
+	outlets := make(map[string]*Outlet)
+	var order []string
+	for _, variable := range u.LastVariables() {
+		m := outletVariable.FindStringSubmatch(variable.Name)
+		if m == nil {
+			continue
+		}
+		prefix := m[1] + "." + m[2]
+		outlet, ok := outlets[prefix]
+		if !ok {
+			outlet = &Outlet{Prefix: prefix}
+			outlets[prefix] = outlet
+			order = append(order, prefix)
+		}
+
+		switch m[3] {
+		case "desc", "name":
+			if v, ok := variable.Value.(string); ok && (outlet.Description == "" || m[3] == "desc") {
+				outlet.Description = v
+			}
+		case "status":
+			if v, ok := variable.Value.(string); ok {
+				outlet.Status = v
+			}
+		case "switchable":
+			outlet.Switchable = variable.Value == "yes"
+		case "realpower":
+			if v, ok := asInt64(variable.Value); ok {
+				outlet.Power = v
+			}
+		case "current":
+			if v, ok := asFloat64(variable.Value); ok {
+				outlet.Current = v
+			}
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		gi, ni := outletKey(order[i])
+		gj, nj := outletKey(order[j])
+		if gi != gj {
+			return !gi
+		}
+		return ni < nj
+	})
+	list := make([]Outlet, 0, len(order))
+	for _, prefix := range order {
+		list = append(list, *outlets[prefix])
+	}
+	return list
+}
+
+// outletKey returns whether the prefix is an outlet group and its number, for sorting
+func outletKey(prefix string) (bool, int) {
+	m := outletVariable.FindStringSubmatch(prefix + ".x")
+	n, _ := strconv.Atoi(m[2])
+	return m[1] == "outlet.group", n
+}
@@ -0,0 +1,92 @@
+package nut
+
+import (
+	"fmt"
+	"strings"
+)
+
+// splitFields splits a line of the NUT network protocol into fields. Fields are separated by
+// spaces, quoted fields may contain spaces, and a backslash escapes the next character
+// (e.g. `VAR ups ups.test "He said \"hi\""` -> [VAR ups ups.test He said "hi"]).
+func splitFields(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	inField, quoted, escaped := false, false, false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			field.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			inField = true
+			escaped = true
+		case r == '"':
+			if quoted {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField, quoted = false, false
+				continue
+			}
+			inField, quoted = true, true
+		case r == ' ' && !quoted:
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			inField = true
+			field.WriteRune(r)
+		}
+	}
+
+	if quoted || escaped {
+		return nil, fmt.Errorf("unterminated quoted string in: %s", line)
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+
+	return fields, nil
+}
+
+// quoteField returns the value as a quoted field of the NUT network protocol, the backslashes and the
+// double quotes escaped with a backslash (e.g. He said "hi" -> "He said \"hi\""). The value must not
+// contain line breaks, see ValidateVariable.
+func quoteField(value string) string {
+	return `"` + fieldEscaper.Replace(value) + `"`
+}
+
+var fieldEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// lastField returns the last field of the line, usually the quoted value of the response.
+func lastField(line string) (string, error) {
+	fields, err := splitFields(line)
+	if err != nil {
+		return "", err
+	}
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty line")
+	}
+	return fields[len(fields)-1], nil
+}
+
+// okResponse reports whether the line is a successful response, "OK" optionally followed by extra
+// info, e.g. "OK TRACKING <id>" of the servers with the command tracking enabled. The extra info is returned.
+func okResponse(line string) (string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != "OK" {
+		return "", false
+	}
+	return strings.Join(fields[1:], " "), true
+}
+
+// listBody returns the lines of the LIST response between the BEGIN and END lines,
+// none for a malformed response without them
+func listBody(resp []string) []string {
+	if len(resp) < 2 {
+		return nil
+	}
+	return resp[1 : len(resp)-1]
+}
@@ -0,0 +1,60 @@
+package nut
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitFields(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+		err  bool
+	}{
+		{line: `VAR ups ups.status "OL"`, want: []string{"VAR", "ups", "ups.status", "OL"}},
+		{line: `VAR ups ups.test "He said \"hi\""`, want: []string{"VAR", "ups", "ups.test", `He said "hi"`}},
+		{line: `VAR ups ups.path "C:\\ups\\"`, want: []string{"VAR", "ups", "ups.path", `C:\ups\`}},
+		{line: `VAR ups ups.id ""`, want: []string{"VAR", "ups", "ups.id", ""}},
+		{line: `UPS ups "Rack  A"`, want: []string{"UPS", "ups", "Rack  A"}},
+		{line: "  BEGIN   LIST UPS ", want: []string{"BEGIN", "LIST", "UPS"}},
+		{line: "", want: nil},
+		{line: `VAR ups ups.id "rack`, err: true},
+		{line: `VAR ups ups.id rack\`, err: true},
+	}
+	for _, tt := range tests {
+		got, err := splitFields(tt.line)
+		if tt.err {
+			if err == nil {
+				t.Errorf("splitFields(%s) = %q, want an error", tt.line, got)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("splitFields(%s) = %q, %v, want %q", tt.line, got, err, tt.want)
+		}
+	}
+}
+
+func TestQuoteField(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "", want: `""`},
+		{value: "plain", want: `"plain"`},
+		{value: "with spaces", want: `"with spaces"`},
+		{value: `He said "hi"`, want: `"He said \"hi\""`},
+		{value: `C:\ups\`, want: `"C:\\ups\\"`},
+		{value: `\"`, want: `"\\\""`},
+	}
+	for _, tt := range tests {
+		got := quoteField(tt.value)
+		if got != tt.want {
+			t.Errorf("quoteField(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+		fields, err := splitFields("VAR ups ups.id " + got)
+		if err != nil || len(fields) != 4 || fields[3] != tt.value {
+			t.Errorf("quoteField(%q) doesn't split back: %q, %v", tt.value, fields, err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package nut
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	defaultPollTimeout    = 5 * time.Second
+	defaultReconnectAfter = 3
+)
+
+// PollConfig - the tunables of the background polling of the UPSs of the server. The zero values keep
+// the polling at the single Interval.
+type PollConfig struct {
+	// Interval is the time between the polls of a UPS
+	Interval time.Duration
+	// FastInterval is the time between the polls of a UPS on battery, to follow the charge and the runtime
+	// closely during an outage. Interval when zero or longer than Interval.
+	FastInterval time.Duration
+	// Jitter delays every poll by a random time up to Jitter, spreading the polls of many UPSs started at once
+	Jitter time.Duration
+	// Timeout is the time the server has to respond to a single command, 5s by default
+	Timeout time.Duration
+	// Budget limits the cumulative time of the commands of a single poll, Interval when zero
+	Budget time.Duration
+	// TimeoutAction is reconnect (default) or skip, ReconnectAfter is the number of consecutive
+	// failed polls after which a skipping UPS reopens its connection, 3 by default
+	TimeoutAction  string
+	ReconnectAfter int
+}
+
+// withDefaults returns the config with the defaults of the unset values, an error for an unknown timeout action
+func (p PollConfig) withDefaults() (PollConfig, error) {
+	switch p.TimeoutAction {
+	case "":
+		p.TimeoutAction = PollTimeoutReconnect
+	case PollTimeoutReconnect, PollTimeoutSkip:
+	default:
+		return p, fmt.Errorf("unknown poll timeout action %q", p.TimeoutAction)
+	}
+	if p.ReconnectAfter <= 0 {
+		p.ReconnectAfter = defaultReconnectAfter
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = defaultPollTimeout
+	}
+	if p.Jitter < 0 {
+		p.Jitter = 0
+	}
+	if p.FastInterval <= 0 || p.FastInterval > p.Interval {
+		p.FastInterval = p.Interval
+	}
+	return p, nil
+}
+
+// nextPoll returns the time until the next poll of the UPS: the fast interval while on battery, with the jitter
+func (u *UPS) nextPoll() time.Duration {
+	poll := u.Client.poll
+	interval := u.PoolInterval
+	if _, status, _ := u.GetStatus(); onBattery(status) {
+		interval = min(interval, poll.FastInterval)
+	}
+	if poll.Jitter > 0 {
+		interval += rand.N(poll.Jitter)
+	}
+	return interval
+}
@@ -0,0 +1,140 @@
+package nut
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// pingAfter - idle time after which a pooled connection is checked before reuse
+const pingAfter = 30 * time.Second
+
+// errPoolExhausted is returned when no pooled connection is freed within the poll timeout
+var errPoolExhausted = errors.New("all pooled connections are busy")
+
+// pool - set of at most size authenticated connections to the NUT server.
+// Connections are opened lazily, checked out for a single command and returned afterward.
+type pool struct {
+	client *Client
+
+	slots chan struct{}
+	idle  chan *pooledConnection
+}
+
+type pooledConnection struct {
+	*connection
+	lastUsed time.Time
+}
+
+func newPool(client *Client, size int) *pool {
+	return &pool{
+		client: client,
+		slots:  make(chan struct{}, size),
+		idle:   make(chan *pooledConnection, size),
+	}
+}
+
+// get checks out a connection, waiting at most the poll timeout for a free slot when all connections are in use.
+// Idle connections are pinged before reuse, broken ones are replaced with a new connection.
+func (p *pool) get() (*pooledConnection, error) {
+	timeout := time.NewTimer(p.client.poll.Timeout)
+	defer timeout.Stop()
+	select {
+	case p.slots <- struct{}{}:
+	case <-timeout.C:
+		return nil, fmt.Errorf("%w: no connection to %s:%s freed within %s", errPoolExhausted, p.client.hostname, p.client.port, p.client.poll.Timeout)
+	}
+
+	select {
+	case conn := <-p.idle:
+		if time.Since(conn.lastUsed) < pingAfter {
+			return conn, nil
+		}
+		_, err := conn.sendCommand("VER")
+		if err == nil {
+			return conn, nil
+		}
+		log.Printf("[DEBUG] discard pooled connection to %s:%s: %v", p.client.hostname, p.client.port, err)
+		conn.close()
+	default:
+	}
+
+	conn, err := newConnection(p.client)
+	if err != nil {
+		<-p.slots
+		return nil, fmt.Errorf("failed to open pooled connection: %w", err)
+	}
+	return &pooledConnection{connection: conn}, nil
+}
+
+// put returns the connection to the pool. The connection is closed instead when the
+// last command failed for another reason than an error reported by the server or a kept timeout.
+func (p *pool) put(conn *pooledConnection, err error) {
+	defer func() { <-p.slots }()
+
+	if err != nil && !isServerError(err) && !p.client.keepsConnection(err) {
+		conn.close()
+		return
+	}
+	conn.lastUsed = time.Now()
+	p.idle <- conn
+}
+
+// do sends the command over a pooled connection. When the connection fails, it is discarded
+// and the command is retried once over another connection when it's retryable. A command that got no connection
+// within the poll timeout is not retried.
+func (p *pool) do(cmd string) ([]string, error) {
+	resp, err := p.send(cmd)
+	if err == nil || isServerError(err) || exceedsLimit(err) || errors.Is(err, errPoolExhausted) || p.client.keepsConnection(err) || !retryable(cmd) {
+		return resp, err
+	}
+	log.Printf("[DEBUG] retry on another pooled connection to %s:%s after failed command: %v", p.client.hostname, p.client.port, err)
+	return p.send(cmd)
+}
+
+func (p *pool) send(cmd string) ([]string, error) {
+	conn, err := p.get()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := conn.sendCommand(cmd)
+	p.put(conn, err)
+	return resp, err
+}
+
+// doStream streams the response of the command over a pooled connection, retried like do.
+// fn then gets the lines of the new response from the start.
+func (p *pool) doStream(cmd string, fn func(line string)) error {
+	err := p.stream(cmd, fn)
+	if err == nil || isServerError(err) || exceedsLimit(err) || errors.Is(err, errPoolExhausted) || p.client.keepsConnection(err) || !retryable(cmd) {
+		return err
+	}
+	log.Printf("[DEBUG] retry on another pooled connection to %s:%s after failed command: %v", p.client.hostname, p.client.port, err)
+	return p.stream(cmd, fn)
+}
+
+func (p *pool) stream(cmd string, fn func(line string)) error {
+	conn, err := p.get()
+	if err != nil {
+		return err
+	}
+	err = conn.streamCommand(cmd, fn)
+	p.put(conn, err)
+	return err
+}
+
+// logout closes all idle connections of the pool
+func (p *pool) logout() {
+	for {
+		select {
+		case conn := <-p.idle:
+			if err := conn.logout(); err != nil {
+				log.Printf("[ERROR] logout from pooled connection to %s:%s: %v", p.client.hostname, p.client.port, err)
+			}
+			conn.close()
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package nut
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPoolGetTimesOut(t *testing.T) {
+	server := newFakeUPSD(t, writeableDevice())
+	client := server.client(t, Config{ConnectionMode: ConnectionPool, ConnectionPoolSize: 1, Poll: PollConfig{Timeout: 50 * time.Millisecond}})
+
+	conn, err := client.pool.get()
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	// the only connection is checked out, the next caller gives up after the poll timeout
+	start := time.Now()
+	if _, err := client.pool.get(); !errors.Is(err, errPoolExhausted) {
+		t.Fatalf("get with all connections busy = %v, want %v", err, errPoolExhausted)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("get gave up after %s, before the poll timeout", elapsed)
+	}
+
+	client.pool.put(conn, nil)
+	conn, err = client.pool.get()
+	if err != nil {
+		t.Fatalf("get after the connection was returned: %v", err)
+	}
+	client.pool.put(conn, nil)
+}
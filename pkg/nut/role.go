@@ -0,0 +1,88 @@
+package nut
+
+import (
+	"fmt"
+	"log"
+)
+
+// Roles of the nutshell session on the UPS: primary may set the forced shutdown, observer only reads,
+// unknown when the server doesn't support the primary status
+const (
+	RolePrimary  = "primary"
+	RoleObserver = "observer"
+	RoleUnknown  = "unknown"
+)
+
+// GetRole returns the role of the session on the UPS. Without ALLOW_FSD the session never asks for the
+// primary status and is an observer. Otherwise the role is the one requested by the polls, see refreshRole,
+// unknown until the first poll. Nothing is sent to the server.
+func (u *UPS) GetRole() string {
+	if u.Client == nil || !u.Client.allowFSD {
+		return RoleObserver
+	}
+	if u.restored {
+		return RoleUnknown
+	}
+
+	u.roleMu.Lock()
+	defer u.roleMu.Unlock()
+	if u.role == "" {
+		return RoleUnknown
+	}
+	return u.role
+}
+
+// refreshRole requests the primary status with PRIMARY, or MASTER for older servers, in the first poll and
+// after a connection was (re)opened. The status belongs to the session, it's lost with the connection and kept
+// until then. It runs in the poll, the handlers only read the cached role.
+func (u *UPS) refreshRole() {
+	if u.Client == nil || !u.Client.allowFSD || u.restored {
+		return
+	}
+	u.roleMu.Lock()
+	fresh := u.role != "" && u.roleConnects == u.Client.connects.Load()
+	u.roleMu.Unlock()
+	if fresh {
+		return
+	}
+
+	role, err := u.queryRole()
+	if err != nil {
+		log.Printf("[WARN] %s: primary status unknown: %v", u.Name, err)
+		role = RoleUnknown
+	}
+	// read after the query, which may open a pooled connection itself
+	connects := u.Client.connects.Load()
+	u.roleMu.Lock()
+	defer u.roleMu.Unlock()
+	u.role, u.roleConnects = role, connects
+}
+
+// queryRole requests the primary status with the command of the protocol version, falling back
+// to the other keyword when the server doesn't know it
+func (u *UPS) queryRole() (string, error) {
+	var role string
+	err := u.withConnection(func(conn *connection) error {
+		cmd := primaryCommand(conn.protocolVersion)
+		resp, err := conn.sendCommand(fmt.Sprintf("%s %s", cmd, u.Name))
+		if isErrorCode(err, "UNKNOWN-COMMAND") {
+			cmd = map[string]string{"PRIMARY": "MASTER", "MASTER": "PRIMARY"}[cmd]
+			resp, err = conn.sendCommand(fmt.Sprintf("%s %s", cmd, u.Name))
+		}
+		switch {
+		case isErrorCode(err, "ACCESS-DENIED"):
+			role = RoleObserver
+			return nil
+		case err != nil:
+			return fmt.Errorf("%s: %w", cmd, err)
+		case len(resp) == 0:
+			return fmt.Errorf("empty response to %s", cmd)
+		}
+		if _, ok := okResponse(resp[0]); !ok {
+			return fmt.Errorf("%s: unexpected response %q", cmd, resp[0])
+		}
+		role = RolePrimary
+		return nil
+	})
+	return role, err
+}
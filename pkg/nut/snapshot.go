@@ -0,0 +1,111 @@
+package nut
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// errRestored is the poll error of a UPS restored from a snapshot, nothing is sent to the server for it
+var errRestored = errors.New("restored from the snapshot, not polled yet")
+
+// Snapshot - the last known state of a UPS, saved across restarts
+type Snapshot struct {
+	Server       string     `json:"server"`
+	Name         string     `json:"name"`
+	Description  string     `json:"description"`
+	Manufacturer string     `json:"manufacturer"`
+	Model        string     `json:"model"`
+	VendorID     string     `json:"vendor_id,omitempty"`
+	ProductID    string     `json:"product_id,omitempty"`
+	Variables    []Variable `json:"variables"`
+	Updated      time.Time  `json:"updated"`
+	Extremes     Extremes   `json:"extremes"`
+	Energy       Energy     `json:"energy"`
+}
+
+// Snapshot returns the last known state of the UPS
+func (u *UPS) Snapshot() Snapshot {
+	energy, _ := u.GetEnergy()
+	return Snapshot{
+		Server:       u.Server,
+		Name:         u.Name,
+		Description:  u.Description,
+		Manufacturer: u.Manufacturer,
+		Model:        u.Model,
+		VendorID:     u.VendorID,
+		ProductID:    u.ProductID,
+		Variables:    u.LastVariables(),
+		Updated:      u.Updated(),
+		Extremes:     u.GetExtremes(),
+		Energy:       energy,
+	}
+}
+
+// Restored reports whether the values of the UPS are the ones from the snapshot, it's not polled yet
+func (u *UPS) Restored() bool {
+	return u.restored
+}
+
+// restoreUPS returns the UPS with the values of the snapshot, shown until the UPS is read from the server.
+// It's not polled and sends nothing to the server.
+func (c *Client) restoreUPS(s Snapshot) *UPS {
+	u := &UPS{
+		Client:       c,
+		Server:       s.Server,
+		PoolInterval: c.poll.Interval,
+		Name:         s.Name,
+		Description:  s.Description,
+		Manufacturer: s.Manufacturer,
+		Model:        s.Model,
+		VendorID:     s.VendorID,
+		ProductID:    s.ProductID,
+		Variables:    restoreVariables(s.Variables),
+		updated:      s.Updated,
+		polled:       time.Now(),
+		pollErr:      errRestored,
+		restored:     true,
+		pollLog:      newThrottle(s.Name, 0),
+	}
+	u.numLogins.Store(-1)
+	u.ID = u.GenerateID()
+	return u
+}
+
+// restoreVariables parses the raw values again, the values decoded from JSON lose their types
+func restoreVariables(list []Variable) []Variable {
+	vars := make([]Variable, 0, len(list))
+	for _, v := range list {
+		v.Value, v.Type = parseValue(v.Raw, v.OriginalType)
+		vars = append(vars, v)
+	}
+	return vars
+}
+
+// restoreHistory continues the extremes and the energy of the snapshot, the energy isn't integrated
+// over the time nutshell was down
+func (u *UPS) restoreHistory(s Snapshot) {
+	u.extremesMu.Lock()
+	if !s.Extremes.Since.IsZero() {
+		u.extremes = s.Extremes
+	}
+	u.extremesMu.Unlock()
+
+	u.energyMu.Lock()
+	if !s.Energy.Since.IsZero() {
+		u.energy = s.Energy
+	}
+	u.energyMu.Unlock()
+	log.Printf("[DEBUG] %s: extremes and energy restored from the snapshot of %s", u.Name, s.Updated.Format(time.DateTime))
+}
+
+// snapshot returns the snapshot of the UPS of the server, false when there is none
+func (c *Client) snapshot(name string) (Snapshot, bool) {
+	for _, s := range c.snapshots {
+		if s.Server == fmt.Sprintf("%s:%s", c.hostname, c.port) && s.Name == name {
+			return s, true
+		}
+	}
+	return Snapshot{}, false
+}
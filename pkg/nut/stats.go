@@ -0,0 +1,33 @@
+package nut
+
+import (
+	"sync/atomic"
+)
+
+// Stats - the traffic of the client with the NUT server since the start, over all its connections
+type Stats struct {
+	// Commands is the number of commands sent, Errors the number of commands failed, including errors
+	// reported by the server
+	Commands      int64
+	Errors        int64
+	BytesSent     int64
+	BytesReceived int64
+}
+
+// stats - the counters of Stats, updated by the connections
+type stats struct {
+	commands atomic.Int64
+	errors   atomic.Int64
+	sent     atomic.Int64
+	received atomic.Int64
+}
+
+// Stats returns the traffic of the client with the NUT server
+func (c *Client) Stats() Stats {
+	return Stats{
+		Commands:      c.stats.commands.Load(),
+		Errors:        c.stats.errors.Load(),
+		BytesSent:     c.stats.sent.Load(),
+		BytesReceived: c.stats.received.Load(),
+	}
+}
@@ -0,0 +1,60 @@
+package nut
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// throttle - rate limiter of the error logs of a repeatedly failing operation. The first failure is logged,
+// repeats are counted and summarized once per interval, and the recovery is logged. Every failure is logged
+// when the interval is zero.
+type throttle struct {
+	name     string
+	interval time.Duration
+
+	mu         sync.Mutex
+	failing    bool
+	since      time.Time
+	lastLog    time.Time
+	suppressed int
+}
+
+func newThrottle(name string, interval time.Duration) *throttle {
+	return &throttle{name: name, interval: interval}
+}
+
+// failure logs the error, or counts it when a log of the failing operation was written within the interval
+func (t *throttle) failure(format string, args ...any) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	msg := fmt.Sprintf(format, args...)
+	now := time.Now()
+	switch {
+	case !t.failing || t.interval == 0:
+		if !t.failing {
+			t.since = now
+		}
+		log.Printf("[ERROR] %s", msg)
+		t.failing, t.lastLog, t.suppressed = true, now, 0
+	case now.Sub(t.lastLog) >= t.interval:
+		log.Printf("[ERROR] %s still failing, %d errors in last %s: %s", t.name, t.suppressed+1, now.Sub(t.lastLog).Round(time.Second), msg)
+		t.lastLog, t.suppressed = now, 0
+	default:
+		t.suppressed++
+	}
+}
+
+// success logs the recovery of the failing operation
+func (t *throttle) success() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.failing {
+		return
+	}
+	log.Printf("[INFO] %s recovered after %s", t.name, time.Since(t.since).Round(time.Second))
+	t.failing, t.suppressed = false, 0
+}
@@ -4,11 +4,17 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"nutshell/pkg/notify"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -25,9 +31,73 @@ type UPS struct {
 	VendorID     string
 	ProductID    string
 
+	// Clients and Variables are replaced by the polls, they are read with ConnectedClients and LastVariables
 	Clients   []string
 	Variables []Variable
 	Commands  []Command
+	varsMu    sync.RWMutex
+
+	// numLogins is the number of clients logged in to the UPS, -1 when the server doesn't report it
+	numLogins atomic.Int64
+
+	conn       *connection
+	pollAborts int64
+	testResult string
+	lastStatus string
+	lastAlarm  string
+	// onBatterySince is the time of the first poll of the current power outage, stableStatus
+	// is the last status not on battery, reported by DebouncedStatus until the outage lasts OnBatteryDelay
+	onBatterySince time.Time
+	stableStatus   string
+	debounceMu     sync.Mutex
+	// pollErr and failures are the result of the last poll, read by the handlers while the poll runs
+	pollErr    error
+	failures   PollFailures
+	failuresMu sync.Mutex
+	// gone is set by the poll or by the update of the UPS list after a reconnect, see stop
+	gone atomic.Bool
+	// restored is set for the UPS created from the snapshot, replaced when it's read from the server
+	restored bool
+	// polled is the end of the last poll, guarded by pollMu
+	polled time.Time
+	// voltageScale is the math.Float64bits of the last correction of the battery voltage, logged when it changes.
+	// The voltage is read by the polls and by the handlers at once.
+	voltageScale atomic.Uint64
+	pollLog      *throttle
+	// updated is the time of the last successful read of the variables, guarded by varsMu
+	updated time.Time
+	pollMu  sync.Mutex
+
+	// role is the role of the session on the UPS requested by the polls, read by the handlers, see GetRole.
+	// roleConnects is the count of the connects of the client when it was requested.
+	role         string
+	roleConnects uint64
+	roleMu       sync.Mutex
+
+	// discharge is the start of the power outage for the stuck battery detection, stuckReported is the last published state.
+	// discharge and stuck are read by the handlers while the poll updates them.
+	discharge     discharge
+	stuck         bool
+	stuckReported bool
+	anomalyMu     sync.Mutex
+
+	// extremes of the metrics since the start or the reset, see GetExtremes
+	extremes   Extremes
+	extremesMu sync.Mutex
+
+	// energy is integrated from the power of consecutive polls, energySample and energyPower are the previous poll
+	energy       Energy
+	energySample time.Time
+	energyPower  float64
+	energyMu     sync.Mutex
+
+	// latency keeps the durations of the recent successful polls, see GetPollLatency
+	latency latency
+
+	meta        map[string]variableMeta
+	metaUpdated time.Time
+	metaMu      sync.Mutex
+	cancel      context.CancelFunc
 }
 
 // https://networkupstools.org/docs/developer-guide.chunked/_variables.html
@@ -39,6 +109,8 @@ type Variable struct {
 	Writeable     bool
 	MaximumLength int
 	OriginalType  string
+	// Raw is the value as reported by the server
+	Raw string
 }
 
 type Command struct {
@@ -46,6 +118,16 @@ type Command struct {
 	Description string
 }
 
+// PollFailures - failed polls of the UPS, consecutive ones are reset by a successful poll
+type PollFailures struct {
+	Consecutive int64
+	Total       int64
+	LastError   string
+	LastFailure time.Time
+}
+
+var errCommandBudgetExceeded = errors.New("command budget exceeded")
+
 var NUTStatusHumanReadable = map[string]string{
 	"OL":      "Online",
 	"OB":      "On Battery",
@@ -65,20 +147,36 @@ var NUTStatusHumanReadable = map[string]string{
 	"COMM":    "Communication Lost",
 }
 
-func NewUPS(ctx context.Context, client *Client, server, name string, poolInterval time.Duration) (*UPS, error) {
+// NewUPS creates the UPS and starts polling it. The description from the LIST UPS line is used as is,
+// GET UPSDESC is sent only when it is empty.
+func NewUPS(ctx context.Context, client *Client, server, name, description string, poolInterval time.Duration) (*UPS, error) {
 	u := &UPS{
 		Client:       client,
 		Server:       server,
 		PoolInterval: poolInterval,
 		Name:         name,
+		Description:  description,
+		pollLog:      newThrottle(fmt.Sprintf("poll of %s on %s", name, server), client.errorLogInterval),
 	}
+	u.numLogins.Store(-1)
 
-	if _, err := u.GetDescription(); err != nil {
-		return nil, fmt.Errorf("failed to get UPS description: %w", err)
+	conn, err := client.connection()
+	if err != nil {
+		return nil, err
+	}
+	u.conn = conn
+
+	if u.Description == "" {
+		if _, err := u.GetDescription(); err != nil {
+			return nil, fmt.Errorf("failed to get UPS description: %w", err)
+		}
 	}
 	if _, err := u.GetClients(); err != nil {
 		return nil, fmt.Errorf("failed to get UPS clients: %w", err)
 	}
+	if _, err := u.GetNumLogins(); err != nil {
+		log.Printf("[DEBUG] %s: %v", u.Name, err)
+	}
 	if _, err := u.GetCommands(); err != nil {
 		return nil, fmt.Errorf("failed to get UPS commands: %w", err)
 	}
@@ -86,24 +184,25 @@ func NewUPS(ctx context.Context, client *Client, server, name string, poolInterv
 		return nil, fmt.Errorf("failed to get UPS variables: %w", err)
 	}
 
-	for _, variable := range u.Variables {
+	// the raw values, a model like 1500 is parsed as a number
+	for _, variable := range u.LastVariables() {
 		if variable.Name == "ups.mfr" {
-			u.Manufacturer = variable.Value.(string)
+			u.Manufacturer = variable.Raw
 		}
 		if variable.Name == "ups.model" {
-			u.Model = variable.Value.(string)
+			u.Model = variable.Raw
 		}
 		if variable.Name == "ups.vendorid" {
 			if val, ok := variable.Value.(string); ok {
 				u.VendorID = val
-			} else if val, ok := variable.Value.(int64); ok {
+			} else if val, ok := asInt64(variable.Value); ok {
 				u.VendorID = strconv.FormatInt(val, 10)
 			}
 		}
 		if variable.Name == "ups.productid" {
 			if val, ok := variable.Value.(string); ok {
 				u.ProductID = val
-			} else if val, ok := variable.Value.(int64); ok {
+			} else if val, ok := asInt64(variable.Value); ok {
 				u.ProductID = strconv.FormatInt(val, 10)
 			}
 		}
@@ -112,23 +211,24 @@ func NewUPS(ctx context.Context, client *Client, server, name string, poolInterv
 
 	u.ID = u.GenerateID()
 
-	tk := time.NewTicker(u.PoolInterval)
+	ctx, u.cancel = context.WithCancel(ctx)
+	u.polled = time.Now()
+	if client.disablePolling {
+		return u, nil
+	}
+
+	// the interval depends on the status, so the timer is reset after every poll
+	tm := time.NewTimer(u.nextPoll())
 	go func() {
 		for {
 			select {
-			case <-tk.C:
-				if _, err := u.GetVariables(); err != nil {
-					log.Printf("[ERROR] failed to poll %s variables: %v", u.Name, err)
-					if err := u.Client.Reconnect(); err == nil {
-						if _, err := u.GetVariables(); err != nil {
-							log.Printf("[ERROR] retry after reconnect failed: %v", err)
-						}
-					} else {
-						log.Printf("[ERROR] reconnect failed: %v", err)
-					}
-				}
+			case <-tm.C:
+				u.pollMu.Lock()
+				u.poll()
+				u.pollMu.Unlock()
+				tm.Reset(u.nextPoll())
 			case <-ctx.Done():
-				tk.Stop()
+				tm.Stop()
 				return
 			}
 		}
@@ -137,6 +237,310 @@ func NewUPS(ctx context.Context, client *Client, server, name string, poolInterv
 	return u, nil
 }
 
+// poll refreshes the UPS variables and clients. The variables poll is aborted when the
+// commands take longer than the command budget, and the connection is reopened.
+// Failed connections are reopened by the commands themselves.
+func (u *UPS) poll() {
+	defer func() { u.polled = time.Now() }()
+
+	start := time.Now()
+	err := u.Client.AuthError()
+	if err == nil {
+		_, err = u.getVariables(u.pollDeadline())
+	}
+	u.failuresMu.Lock()
+	u.pollErr = err
+	u.failuresMu.Unlock()
+	if isErrorCode(err, "UNKNOWN-UPS") {
+		u.stop()
+		return
+	}
+	u.countFailure(err)
+	if err == nil {
+		u.latency.add(time.Since(start))
+		u.debounce()
+		u.detectStuckBattery()
+		u.trackExtremes()
+	}
+	u.integrateEnergy(err != nil)
+	u.publish(err)
+
+	failed := err != nil
+	if errors.Is(err, errCommandBudgetExceeded) {
+		u.pollAborts++
+		log.Printf("[DEBUG] %s poll aborted after exceeding the command budget of %s (%d aborts)", u.Name, u.commandBudget(), u.pollAborts)
+	} else if err != nil {
+		u.pollLog.failure("failed to poll %s variables: %v", u.Name, err)
+	}
+	// the credentials were rejected, nothing more is sent until the configuration is fixed
+	if isAuthError(err) {
+		return
+	}
+	if u.reconnectAfterFailure(err) {
+		if err := u.reconnect(); err != nil {
+			u.pollLog.failure("reconnect of %s failed: %v", u.Name, err)
+		}
+	}
+	if _, err := u.GetClients(); err != nil {
+		failed = true
+		u.pollLog.failure("failed to poll %s clients: %v", u.Name, err)
+	} else if _, err := u.GetNumLogins(); err != nil && !isServerError(err) {
+		u.pollLog.failure("failed to poll %s logins: %v", u.Name, err)
+	}
+	u.refreshRole()
+	if !failed {
+		u.pollLog.success()
+	}
+
+	if result, err := u.GetTestResult(); err == nil && result != u.testResult {
+		if u.testResult != "" {
+			level := "INFO"
+			if strings.Contains(strings.ToLower(result), "fail") {
+				level = "WARN"
+			}
+			log.Printf("[%s] %s self-test result changed from %q to %q", level, u.Name, u.testResult, result)
+		}
+		u.testResult = result
+	}
+}
+
+// countFailure updates the failure counters with the result of the poll
+func (u *UPS) countFailure(err error) {
+	u.failuresMu.Lock()
+	defer u.failuresMu.Unlock()
+	if err == nil {
+		u.failures.Consecutive = 0
+		return
+	}
+	u.failures.Consecutive++
+	u.failures.Total++
+	u.failures.LastError = err.Error()
+	u.failures.LastFailure = time.Now()
+}
+
+// stop stops polling the UPS removed from the server and releases its connection, the UPS is kept as gone
+func (u *UPS) stop() {
+	if !u.gone.CompareAndSwap(false, true) {
+		return
+	}
+	log.Printf("[WARN] %s was removed from %s, polling stopped", u.Name, u.Server)
+	if u.restored {
+		return
+	}
+	u.cancel()
+	u.Client.release(u.conn)
+}
+
+// reconnectAfterFailure reports whether the connection must be reopened after the failed poll. With the skip
+// action, the connection is kept until ReconnectAfter consecutive polls failed, and it's reopened only after
+// a timeout or a connection failure: an error reported by the server, e.g. DATA-STALE, comes over a working
+// connection. Other connection failures are handled by the commands themselves.
+func (u *UPS) reconnectAfterFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if u.Client.poll.TimeoutAction == PollTimeoutSkip {
+		if isServerError(err) {
+			return false
+		}
+		failed := u.Failures().Consecutive
+		if failed%int64(u.Client.poll.ReconnectAfter) != 0 {
+			return false
+		}
+		log.Printf("[INFO] reconnect %s after %d failed polls", u.Name, failed)
+		return true
+	}
+	return errors.Is(err, errCommandBudgetExceeded)
+}
+
+// publish sends the poll result and the status change to the notifier
+func (u *UPS) publish(err error) {
+	n := u.Client.notifier
+	if n == nil {
+		return
+	}
+	ctx := context.Background()
+	id := notify.UPS{ID: u.ID, Name: u.Name, Server: u.Server}
+	now := time.Now()
+
+	if err != nil {
+		_ = n.OnError(ctx, notify.Error{UPS: id, Err: err, Time: now})
+		return
+	}
+
+	_, raw, _ := u.GetStatus()
+	status := u.DebouncedStatus()
+	last := u.LastVariables()
+	variables := make(map[string]any, len(last))
+	for _, v := range last {
+		variables[v.Name] = v.Value
+	}
+	_ = n.OnPoll(ctx, notify.Poll{UPS: id, Status: raw, Variables: variables, Time: now})
+
+	alarm, alarmed := u.GetAlarm()
+	if alarmed && alarm == "" {
+		alarm = "Alarm"
+	}
+	if u.lastStatus != "" && status != u.lastStatus {
+		_ = n.OnStatusChange(ctx, notify.StatusChange{UPS: id, Previous: u.lastStatus, Status: status, Time: now})
+	}
+	if u.lastStatus != "" && alarm != u.lastAlarm {
+		_ = n.OnAlarm(ctx, notify.Alarm{UPS: id, Previous: u.lastAlarm, Alarm: alarm, Time: now})
+	}
+	if _, stuck := u.StuckBattery(); stuck != u.stuckReported {
+		e := notify.Anomaly{UPS: id, Kind: AnomalyStuckBattery, Active: stuck, Time: now}
+		if stuck {
+			e.Message = u.StuckBatteryMessage()
+		}
+		_ = n.OnAnomaly(ctx, e)
+		u.stuckReported = stuck
+	}
+	u.lastStatus = status
+	u.lastAlarm = alarm
+}
+
+// Refresh polls the UPS when the background polling is disabled and the last poll is older than
+// the pool interval. Concurrent requests wait for a single poll. A UPS without a client is never polled.
+func (u *UPS) Refresh() {
+	if u.Client == nil || !u.Client.disablePolling {
+		return
+	}
+	u.PollIfOlder(u.PoolInterval)
+}
+
+// PollIfOlder polls the UPS out of band when the last poll is older than maxAge, and reports whether it polled.
+// Polls are serialized with the background polling, a poll that just finished is not repeated.
+func (u *UPS) PollIfOlder(maxAge time.Duration) bool {
+	if u.gone.Load() || u.restored {
+		return false
+	}
+	u.pollMu.Lock()
+	defer u.pollMu.Unlock()
+	if time.Since(u.polled) < maxAge {
+		return false
+	}
+	u.poll()
+	return true
+}
+
+// Healthy reports whether the last poll of the UPS succeeded
+func (u *UPS) Healthy() bool {
+	if u.gone.Load() {
+		return false
+	}
+	u.failuresMu.Lock()
+	failed := u.pollErr != nil
+	u.failuresMu.Unlock()
+	return !failed && len(u.LastVariables()) > 0
+}
+
+// Failures returns the counters of failed polls and the last poll error
+func (u *UPS) Failures() PollFailures {
+	u.failuresMu.Lock()
+	defer u.failuresMu.Unlock()
+	return u.failures
+}
+
+// Reconnecting reports whether the last poll failed, the variables are the last snapshot read before the failure
+func (u *UPS) Reconnecting() bool {
+	return !u.gone.Load() && u.Failures().Consecutive > 0
+}
+
+// Expired reports whether the last successful read of the variables is older than MaxStaleness. The values
+// are too old to be shown, the variables are hidden and the UPS has no status until a poll succeeds.
+func (u *UPS) Expired() bool {
+	if u.gone.Load() || u.Client == nil || u.Client.maxStaleness <= 0 {
+		return false
+	}
+	updated := u.Updated()
+	return !updated.IsZero() && time.Since(updated) > u.Client.maxStaleness
+}
+
+// CurrentVariables returns the variables of the UPS, none when they expired
+func (u *UPS) CurrentVariables() []Variable {
+	if u.Expired() {
+		return nil
+	}
+	return u.LastVariables()
+}
+
+// LastVariables returns the variables of the last successful read, also when they expired
+func (u *UPS) LastVariables() []Variable {
+	u.varsMu.RLock()
+	defer u.varsMu.RUnlock()
+	return u.Variables
+}
+
+// ConnectedClients returns the clients connected to the UPS as read by the last poll
+func (u *UPS) ConnectedClients() []string {
+	u.varsMu.RLock()
+	defer u.varsMu.RUnlock()
+	return u.Clients
+}
+
+// Updated returns the time of the last successful read of the variables
+func (u *UPS) Updated() time.Time {
+	u.varsMu.RLock()
+	defer u.varsMu.RUnlock()
+	return u.updated
+}
+
+// Device - the identity of the UPS read by its introspection, Server is the host:port of the NUT server
+type Device struct {
+	ID           string
+	Name         string
+	Server       string
+	Description  string
+	Manufacturer string
+	Model        string
+	VendorID     string
+	ProductID    string
+}
+
+// Device returns the identity of the UPS
+func (u *UPS) Device() Device {
+	return Device{
+		ID:           u.ID,
+		Name:         u.Name,
+		Server:       u.Server,
+		Description:  u.Description,
+		Manufacturer: u.Manufacturer,
+		Model:        u.Model,
+		VendorID:     u.VendorID,
+		ProductID:    u.ProductID,
+	}
+}
+
+// SupportedCommands returns the instant commands of the UPS read by its introspection
+func (u *UPS) SupportedCommands() []Command {
+	return u.Commands
+}
+
+// ServerName returns the display name of the server of the UPS, the alias of the server when configured.
+// Server keeps host:port, which identifies the UPS.
+func (u *UPS) ServerName() string {
+	if u.Client != nil && u.Client.alias != "" {
+		return u.Client.alias
+	}
+	return u.Server
+}
+
+// Gone reports whether the UPS was removed from the server, the UPS is not polled anymore
+func (u *UPS) Gone() bool {
+	return u.gone.Load()
+}
+
+// commandBudget returns the maximum cumulative time of commands in a single poll
+func (u *UPS) commandBudget() time.Duration {
+	if u.Client.poll.Budget > 0 {
+		return u.Client.poll.Budget
+	}
+	return u.PoolInterval
+}
+func (u *UPS) pollDeadline() time.Time {
+	return time.Now().Add(u.commandBudget())
+}
+
 func (u *UPS) GenerateID() string {
 	hasher := md5.New()
 	input := []byte(u.Server)
@@ -155,56 +559,173 @@ func (u *UPS) GenerateID() string {
 }
 
 func (u *UPS) GetStatus() (string, string, error) {
+	if u.gone.Load() {
+		return "Removed", "", nil
+	}
+	if u.Expired() {
+		return "No data", "", nil
+	}
+
 	var statusCode string
 
-	if value, ok := u.getVariable("ups.status").(string); ok {
+	if value, ok := u.StringVar("ups.status"); ok {
 		statusCode = value
 	}
 
+	// the charger status is more precise than the CHRG and DISCHRG flags, it replaces them when reported
+	charger, hasCharger := u.GetChargerStatus()
+
 	var descriptions []string
 	for _, code := range strings.Fields(statusCode) {
+		if hasCharger && (code == "CHRG" || code == "DISCHRG") {
+			continue
+		}
 		if desc, ok := NUTStatusHumanReadable[code]; ok {
 			if len(descriptions) > 0 {
 				desc = strings.ToLower(desc)
 			}
+			if alarm, _ := u.GetAlarm(); code == "ALARM" && alarm != "" {
+				desc += ": " + alarm
+			}
 			descriptions = append(descriptions, desc)
 		} else {
 			descriptions = append(descriptions, "Unknown")
 		}
 	}
+	if hasCharger {
+		desc := ChargerDescription(charger)
+		if len(descriptions) > 0 {
+			desc = strings.ToLower(desc)
+		}
+		descriptions = append(descriptions, desc)
+	}
 
 	return strings.Join(descriptions, ", "), statusCode, nil
 }
+
+// onBattery reports whether the status code has the OB flag
+func onBattery(status string) bool {
+	return slices.Contains(strings.Fields(status), "OB")
+}
+
+// debounce tracks the start of the power outage and the last status before it
+func (u *UPS) debounce() {
+	_, status, _ := u.GetStatus()
+	u.debounceMu.Lock()
+	defer u.debounceMu.Unlock()
+	if !onBattery(status) {
+		u.onBatterySince = time.Time{}
+		u.stableStatus = status
+		return
+	}
+	if u.onBatterySince.IsZero() {
+		u.onBatterySince = time.Now()
+	}
+}
+
+// DebouncedStatus returns the status code with brief mains dropouts ignored. The UPS on battery for less than
+// OnBatteryDelay keeps the status from before the outage, back on line is reported right away.
+// The UPS on battery since the start of nutshell has no previous status, its status is reported as is.
+func (u *UPS) DebouncedStatus() string {
+	_, status, _ := u.GetStatus()
+	u.debounceMu.Lock()
+	defer u.debounceMu.Unlock()
+	if !onBattery(status) || u.stableStatus == "" || u.onBatterySince.IsZero() {
+		return status
+	}
+	if time.Since(u.onBatterySince) >= u.Client.onBatteryDelay {
+		return status
+	}
+	return u.stableStatus
+}
+
+// GetAlarm returns the text of ups.alarm and whether the ALARM flag is set in ups.status. The text may be empty
+// when the driver sets the flag without details.
+func (u *UPS) GetAlarm() (string, bool) {
+	status, _ := u.StringVar("ups.status")
+	if !slices.Contains(strings.Fields(status), "ALARM") {
+		return "", false
+	}
+	alarm, _ := u.StringVar("ups.alarm")
+	return strings.TrimSpace(alarm), true
+}
+
 func (u *UPS) GetBattery() (int64, int64, float64, error) {
 	var charge int64 = 0
 	var low int64 = 0
 	var voltage = 0.0
 
-	if value, ok := u.getVariable("battery.charge").(int64); ok {
+	if value, ok := u.IntVar("battery.charge"); ok {
 		charge = value
 	}
-	if value, ok := u.getVariable("battery.charge.low").(int64); ok {
+	if value, ok := u.IntVar("battery.charge.low"); ok {
 		low = value
 	}
-	if value, ok := u.getVariable("battery.voltage").(float64); ok {
-		voltage = value
-	}
+	voltage = u.GetBatteryVoltage().Value
 
 	return charge, low, voltage, nil
 }
+
+// BatteryVoltage - battery voltage reported by the driver, and the value corrected for an obvious scale mismatch
+type BatteryVoltage struct {
+	Raw     float64
+	Nominal float64
+	Value   float64
+	// Scale is the factor applied to the raw value, 1 when not corrected
+	Scale float64
+}
+
+// GetBatteryVoltage returns the battery voltage, checked against battery.voltage.nominal. Some drivers report
+// the voltage in a different scale than the nominal one (e.g. per cell or per pack, or in tenths of volts).
+// The voltage is corrected only when it's far off the nominal voltage and exactly one of the usual scales fits.
+func (u *UPS) GetBatteryVoltage() BatteryVoltage {
+	raw, _ := u.FloatVar("battery.voltage")
+	nominal, _ := u.FloatVar("battery.voltage.nominal")
+	v := BatteryVoltage{Raw: raw, Nominal: nominal, Value: raw, Scale: 1}
+	if raw <= 0 || nominal <= 0 || plausibleVoltage(raw, nominal) {
+		return v
+	}
+
+	scales := []float64{10, 0.1, 100, 0.01}
+	if packs, ok := u.IntVar("battery.packs"); ok && packs > 1 {
+		scales = append(scales, float64(packs), 1/float64(packs))
+	}
+	var fits []float64
+	for _, scale := range scales {
+		if plausibleVoltage(raw*scale, nominal) {
+			fits = append(fits, scale)
+		}
+	}
+	if len(fits) != 1 {
+		return v
+	}
+
+	v.Scale = fits[0]
+	v.Value = math.Round(raw*v.Scale*100) / 100
+	if scale := math.Float64bits(v.Scale); u.voltageScale.Swap(scale) != scale {
+		log.Printf("[WARN] %s: battery.voltage %gV doesn't match the nominal %gV, shown as %gV", u.Name, raw, nominal, v.Value)
+	}
+	return v
+}
+
+// plausibleVoltage reports whether the voltage is in the range of a discharged to a charging battery
+func plausibleVoltage(voltage, nominal float64) bool {
+	ratio := voltage / nominal
+	return ratio >= 0.6 && ratio <= 1.5
+}
 func (u *UPS) GetLoad() (int64, int64, error) {
 	var load int64 = 0
-	if value, ok := u.getVariable("ups.load").(int64); ok {
+	if value, ok := u.IntVar("ups.load"); ok {
 		load = value
 	}
 
 	var power int64 = 0
-	if value, ok := u.getVariable("ups.realpower").(int64); ok {
+	if value, ok := u.measuredPower(); ok {
 		power = value
 	} else {
-		if value, ok := u.getVariable("ups.realpower.nominal").(int64); ok {
+		if value, ok := u.IntVar("ups.realpower.nominal"); ok {
 			power = value
-		} else if value, ok := u.getVariable("ups.power.nominal").(int64); ok {
+		} else if value, ok := u.IntVar("ups.power.nominal"); ok {
 			power = value
 		}
 		power = load * power / 100
@@ -213,45 +734,137 @@ func (u *UPS) GetLoad() (int64, int64, error) {
 	return load, power, nil
 }
 func (u *UPS) GetRuntime() (int64, error) {
-	if value, ok := u.getVariable("battery.runtime").(int64); ok {
+	if value, ok := u.IntVar("battery.runtime"); ok {
 		return value, nil
 	}
 	return 0, fmt.Errorf("battery.runtime variable not found")
 }
 
+// GetRuntimeToLowBattery estimates the seconds until the UPS reports the low battery and the clients shut down.
+// The remaining runtime is reduced by battery.runtime.low when reported, otherwise by the share of battery.charge.low.
+func (u *UPS) GetRuntimeToLowBattery() (int64, error) {
+	if status, _ := u.StringVar("ups.status"); slices.Contains(strings.Fields(status), "LB") {
+		return 0, nil
+	}
+	runtime, err := u.GetRuntime()
+	if err != nil {
+		return 0, err
+	}
+	if low, ok := u.IntVar("battery.runtime.low"); ok {
+		return max(runtime-low, 0), nil
+	}
+	charge, chargeOK := u.IntVar("battery.charge")
+	low, lowOK := u.IntVar("battery.charge.low")
+	if !chargeOK || !lowOK || charge <= 0 {
+		return 0, fmt.Errorf("battery.runtime.low or battery.charge.low variable not found")
+	}
+	return max(runtime*(charge-low)/charge, 0), nil
+}
+
+// GetShutdownDelay returns the delay in seconds between the shutdown command and cutting the power.
+// GetStartDelay returns the delay in seconds before the UPS restores the power after the shutdown.
+func (u *UPS) GetShutdownDelay() (int64, error) {
+	if value, ok := u.IntVar("ups.delay.shutdown"); ok {
+		return value, nil
+	}
+	return 0, fmt.Errorf("ups.delay.shutdown variable not found")
+}
+func (u *UPS) GetStartDelay() (int64, error) {
+	if value, ok := u.IntVar("ups.delay.start"); ok {
+		return value, nil
+	}
+	return 0, fmt.Errorf("ups.delay.start variable not found")
+}
+
+// GetTestResult returns the result of the last self-test, e.g. "Done and passed"
+func (u *UPS) GetTestResult() (string, error) {
+	if value, ok := u.StringVar("ups.test.result"); ok {
+		return value, nil
+	}
+	return "", fmt.Errorf("ups.test.result variable not found")
+}
+
+// GetBeeper returns the beeper status: enabled, disabled or muted
+func (u *UPS) GetBeeper() (string, error) {
+	if value, ok := u.BoolVar("ups.beeper.status"); ok {
+		if value {
+			return "enabled", nil
+		}
+		return "disabled", nil
+	}
+	if value, ok := u.StringVar("ups.beeper.status"); ok {
+		return value, nil
+	}
+	return "", fmt.Errorf("ups.beeper.status variable not found")
+}
+
 func (u *UPS) GetDescription() (string, error) {
-	resp, err := u.Client.sendCommand(fmt.Sprintf("GET UPSDESC %s", u.Name))
+	resp, err := u.sendCommand(fmt.Sprintf("GET UPSDESC %s", u.Name))
 	if err != nil {
 		return "", fmt.Errorf("failed to get UPS description: %w", err)
 	}
-	description := strings.TrimPrefix(strings.Replace(resp[0], `"`, "", -1), fmt.Sprintf(`UPSDESC %s `, u.Name))
+	description, err := lastField(resp[0])
+	if err != nil {
+		return "", fmt.Errorf("failed to parse UPS description: %w", err)
+	}
 	u.Description = description
 	return description, nil
 }
 func (u *UPS) GetClients() ([]string, error) {
-	resp, err := u.Client.sendCommand(fmt.Sprintf("LIST CLIENT %s", u.Name))
+	resp, err := u.sendCommand(fmt.Sprintf("LIST CLIENT %s", u.Name))
 	if err != nil {
 		return nil, fmt.Errorf("failed to list clients: %w", err)
 	}
 
 	linePrefix := fmt.Sprintf("CLIENT %s ", u.Name)
 	clientsList := []string{}
-	for _, line := range resp[1 : len(resp)-1] {
+	for _, line := range listBody(resp) {
 		clientsList = append(clientsList, strings.TrimPrefix(line, linePrefix))
 	}
+	u.varsMu.Lock()
 	u.Clients = clientsList
+	u.varsMu.Unlock()
 
 	return clientsList, nil
 }
+
+// GetNumLogins returns the number of clients logged in to the UPS with LOGIN, usually the upsmon instances
+// shutting down with it, as reported by GET NUMLOGINS
+func (u *UPS) GetNumLogins() (int64, error) {
+	resp, err := u.sendCommand(fmt.Sprintf("GET NUMLOGINS %s", u.Name))
+	if err != nil {
+		if isServerError(err) {
+			u.numLogins.Store(-1)
+		}
+		return 0, fmt.Errorf("failed to get number of logins: %w", err)
+	}
+	value, err := lastField(resp[0])
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse number of logins: %w", err)
+	}
+	logins, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number of logins %q: %w", value, err)
+	}
+	u.numLogins.Store(logins)
+	return logins, nil
+}
+
+// NumLogins returns the number of clients logged in to the UPS read by the last poll, false when not known
+func (u *UPS) NumLogins() (int64, bool) {
+	logins := u.numLogins.Load()
+	return logins, logins >= 0
+}
+
 func (u *UPS) GetCommands() ([]Command, error) {
-	resp, err := u.Client.sendCommand(fmt.Sprintf("LIST CMD %s", u.Name))
+	resp, err := u.sendCommand(fmt.Sprintf("LIST CMD %s", u.Name))
 	if err != nil {
 		return nil, fmt.Errorf("failed to list commands: %w", err)
 	}
 
 	commandsList := []Command{}
 	linePrefix := fmt.Sprintf("CMD %s ", u.Name)
-	for _, line := range resp[1 : len(resp)-1] {
+	for _, line := range listBody(resp) {
 		cmdName := strings.TrimPrefix(line, linePrefix)
 		cmd := Command{
 			Name: cmdName,
@@ -268,110 +881,175 @@ func (u *UPS) GetCommands() ([]Command, error) {
 	return commandsList, nil
 }
 func (u *UPS) GetVariables() ([]Variable, error) {
-	resp, err := u.Client.sendCommand(fmt.Sprintf("LIST VAR %s", u.Name))
+	return u.getVariables(time.Time{})
+}
+
+// getVariables lists the variables of the UPS, giving up when the deadline passes (zero means no deadline)
+func (u *UPS) getVariables(deadline time.Time) ([]Variable, error) {
+	// the lines are parsed as they are read, the metadata is queried after the response
+	// because the commands can't be sent on the connection in the middle of it
+	type value struct{ name, value string }
+	var values []value
+	err := u.streamCommand(fmt.Sprintf("LIST VAR %s", u.Name), func(line string) {
+		if strings.HasPrefix(line, "BEGIN ") {
+			// the response of a retried command starts again
+			values = values[:0]
+			return
+		}
+		fields, err := splitFields(line)
+		if err != nil || len(fields) < 4 || fields[0] != "VAR" || u.Client.ignored(fields[2]) {
+			return
+		}
+		values = append(values, value{name: fields[2], value: strings.TrimSpace(fields[3])})
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list variables: %w", err)
 	}
 
-	var vars []Variable
-	offset := fmt.Sprintf("VAR %s ", u.Name)
-	for _, line := range resp[1 : len(resp)-1] {
-		cleanedLine := strings.TrimPrefix(line, offset)
-		splitLine := strings.SplitN(cleanedLine, `"`, 3)
-		if len(splitLine) < 2 {
-			continue
-		}
-		name := strings.TrimSpace(strings.TrimSuffix(splitLine[0], " "))
-		valueStr := strings.TrimSpace(splitLine[1])
+	refresh := u.metadataExpired()
+	names := make([]string, 0, len(values))
+	for _, v := range values {
+		names = append(names, v.name)
+	}
+	prefetched, err := u.prefetchMetadata(names, refresh)
+	if err != nil {
+		return nil, err
+	}
+	// the prefetched metadata is fresh, it's taken from the cache below
+	fetch := refresh && !prefetched
 
-		description, err := u.GetVariableDescription(name)
-		if err != nil {
-			return nil, err
+	vars := make([]Variable, 0, len(values))
+	for _, v := range values {
+		name, valueStr := v.name, v.value
+
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return nil, errCommandBudgetExceeded
 		}
-		varType, writeable, maximumLength, err := u.GetVariableType(name)
+
+		meta, err := u.metadata(name, fetch)
 		if err != nil {
 			return nil, err
 		}
 
 		newVar := Variable{
 			Name:          name,
-			Description:   description,
-			Type:          varType,
-			Writeable:     writeable,
-			MaximumLength: maximumLength,
+			Description:   meta.description,
+			Type:          meta.varType,
+			Writeable:     meta.writeable,
+			MaximumLength: meta.maximumLength,
 			Value:         valueStr,
-			OriginalType:  varType,
-		}
-
-		switch valueStr {
-		case "enabled":
-			newVar.Value = true
-			newVar.Type = "BOOLEAN"
-		case "disabled":
-			newVar.Value = false
-			newVar.Type = "BOOLEAN"
-		default:
-			if matched, _ := regexp.MatchString(`^-?\d+(\.\d+)?$`, valueStr); matched {
-				if strings.Contains(valueStr, ".") {
-					if f, err := strconv.ParseFloat(valueStr, 64); err == nil {
-						newVar.Value = f
-						newVar.Type = "FLOAT_64"
-					}
-				} else {
-					if i, err := strconv.ParseInt(valueStr, 10, 64); err == nil {
-						newVar.Value = i
-						newVar.Type = "INTEGER"
-					}
-				}
-			} else {
-				newVar.Type = "STRING"
-			}
+			Raw:           valueStr,
+			OriginalType:  meta.varType,
 		}
 
+		newVar.Value, newVar.Type = parseValue(valueStr, meta.varType)
+
 		vars = append(vars, newVar)
 	}
+	if refresh {
+		u.metadataRefreshed(names)
+	}
+	u.varsMu.Lock()
 	u.Variables = vars
+	u.updated = time.Now()
+	u.varsMu.Unlock()
 
 	return vars, nil
 }
 
+// parseValue converts the variable value to bool, int64 or float64 when possible, and returns it with its type.
+// The type falls back to varType for a number out of range.
+func parseValue(value, varType string) (any, string) {
+	switch value {
+	case "enabled":
+		return true, "BOOLEAN"
+	case "disabled":
+		return false, "BOOLEAN"
+	}
+	if matched, _ := regexp.MatchString(`^-?\d+(\.\d+)?$`, value); !matched {
+		return value, "STRING"
+	}
+	if strings.Contains(value, ".") {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f, "FLOAT_64"
+		}
+	} else if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return i, "INTEGER"
+	}
+	return value, varType
+}
+
+// GetVariableValue reads the current value of a single variable with GET VAR,
+// much cheaper than listing all variables for a targeted refresh
+func (u *UPS) GetVariableValue(variableName string) (any, error) {
+	resp, err := u.sendCommand(fmt.Sprintf("GET VAR %s %s", u.Name, variableName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get variable %s: %w", variableName, err)
+	}
+
+	value, err := lastField(resp[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse variable %s: %w", variableName, err)
+	}
+	v, _ := parseValue(strings.TrimSpace(value), "")
+
+	return v, nil
+}
+
 func (u *UPS) GetCommandDescription(commandName string) (string, error) {
-	resp, err := u.Client.sendCommand(fmt.Sprintf("GET CMDDESC %s %s", u.Name, commandName))
+	resp, err := u.sendCommand(fmt.Sprintf("GET CMDDESC %s %s", u.Name, commandName))
 	if err != nil {
 		return "", fmt.Errorf("failed to get command description: %w", err)
 	}
 
-	trimmedLine := strings.TrimPrefix(resp[0], fmt.Sprintf("CMDDESC %s %s ", u.Name, commandName))
-	description := strings.Replace(trimmedLine, `"`, "", -1)
+	description, err := lastField(resp[0])
+	if err != nil {
+		return "", fmt.Errorf("failed to parse command description: %w", err)
+	}
 
 	return description, nil
 }
 func (u *UPS) GetVariableDescription(variableName string) (string, error) {
-	resp, err := u.Client.sendCommand(fmt.Sprintf("GET DESC %s %s", u.Name, variableName))
+	resp, err := u.sendCommand(fmt.Sprintf("GET DESC %s %s", u.Name, variableName))
 	if err != nil {
 		return "", fmt.Errorf("failed to get variable description: %w", err)
 	}
 
-	trimmedLine := strings.TrimPrefix(resp[0], fmt.Sprintf("DESC %s %s ", u.Name, variableName))
-	description := strings.Replace(trimmedLine, `"`, "", -1)
+	return parseDescription(resp[0])
+}
 
+// parseDescription parses the response to GET DESC
+func parseDescription(line string) (string, error) {
+	description, err := lastField(line)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse variable description: %w", err)
+	}
 	return description, nil
 }
+
 func (u *UPS) GetVariableType(variableName string) (string, bool, int, error) {
-	resp, err := u.Client.sendCommand(fmt.Sprintf("GET TYPE %s %s", u.Name, variableName))
+	resp, err := u.sendCommand(fmt.Sprintf("GET TYPE %s %s", u.Name, variableName))
 	if err != nil {
 		return "UNKNOWN", false, -1, fmt.Errorf("failed to get type of variable %s: %w", variableName, err)
 	}
+	return u.parseType(variableName, resp[0])
+}
 
-	trimmedLine := strings.TrimPrefix(resp[0], fmt.Sprintf("TYPE %s %s ", u.Name, variableName))
+// parseType parses the response to GET TYPE into the type, whether the variable is writeable and the maximum length of strings
+func (u *UPS) parseType(variableName, line string) (string, bool, int, error) {
+	var err error
+	trimmedLine := strings.TrimPrefix(line, fmt.Sprintf("TYPE %s %s ", u.Name, variableName))
 	splitLine := strings.Split(trimmedLine, " ")
 	writeable := splitLine[0] == "RW"
 	varType := "UNKNOWN"
 	maximumLength := 0
+	if writeable && len(splitLine) < 2 {
+		return varType, writeable, -1, fmt.Errorf("invalid type of variable %s: %q", variableName, line)
+	}
 	if writeable {
 		varType = splitLine[1]
 		if strings.HasPrefix(varType, "STRING:") {
-			splitType := strings.Split(varType, ":")
+			splitType := strings.SplitN(varType, ":", 2)
 			varType = splitType[0]
 			maximumLength, err = strconv.Atoi(splitType[1])
 			if err != nil {
@@ -385,41 +1063,389 @@ func (u *UPS) GetVariableType(variableName string) (string, bool, int, error) {
 	return varType, writeable, maximumLength, nil
 }
 
-func (u *UPS) ForceShutdown() (bool, error) {
-	resp, err := u.Client.sendCommand(fmt.Sprintf("FSD %s", u.Name))
+func (u *UPS) GetVariableRanges(variableName string) ([][2]float64, error) {
+	resp, err := u.sendCommand(fmt.Sprintf("LIST RANGE %s %s", u.Name, variableName))
 	if err != nil {
-		return false, fmt.Errorf("failed to send force shutdown command: %w", err)
+		return nil, fmt.Errorf("failed to list ranges of variable %s: %w", variableName, err)
 	}
-	if len(resp) == 0 || resp[0] != "OK FSD-SET" {
-		return false, fmt.Errorf("force shutdown command failed: %s", resp)
+	if len(resp) < 2 {
+		return nil, nil
 	}
-	return true, nil
+
+	var ranges [][2]float64
+	for _, line := range listBody(resp) {
+		fields, err := splitFields(line)
+		if err != nil || len(fields) < 5 {
+			continue
+		}
+		minimum, err := strconv.ParseFloat(fields[3], 64)
+		if err != nil {
+			continue
+		}
+		maximum, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			continue
+		}
+		ranges = append(ranges, [2]float64{minimum, maximum})
+	}
+
+	return ranges, nil
 }
 
-func (u *UPS) SetVariable(variableName, value string) (bool, error) {
-	resp, err := u.Client.sendCommand(fmt.Sprintf(`SET VAR %s %s "%s"`, u.Name, variableName, value))
+// GetVariableEnums returns the allowed values of the ENUM variable
+func (u *UPS) GetVariableEnums(variableName string) ([]string, error) {
+	resp, err := u.sendCommand(fmt.Sprintf("LIST ENUM %s %s", u.Name, variableName))
 	if err != nil {
-		return false, err
+		return nil, fmt.Errorf("failed to list enums of variable %s: %w", variableName, err)
 	}
-	if len(resp) == 0 || resp[0] != "OK" {
-		return false, fmt.Errorf("failed to set variable %s to %s: %s", variableName, value, resp)
+
+	var enums []string
+	for _, line := range listBody(resp) {
+		fields, err := splitFields(line)
+		if err != nil || len(fields) < 4 {
+			continue
+		}
+		enums = append(enums, fields[3])
+	}
+
+	return enums, nil
+}
+
+// ValidationError - the value can't be set to the variable, reported before anything is sent to the server
+type ValidationError struct {
+	Variable string
+	Reason   string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Reason
+}
+
+func invalid(variableName, format string, args ...any) error {
+	return &ValidationError{Variable: variableName, Reason: fmt.Sprintf(format, args...)}
+}
+
+// ValidateVariable checks the value can be set to the variable: the variable must be known and writeable,
+// numbers must be within the variable ranges, enums one of the allowed values, strings must fit the maximum length,
+// and delays must be a non-negative number of seconds. Line breaks, which would end the SET VAR command, aren't allowed.
+// The errors are *ValidationError.
+func (u *UPS) ValidateVariable(variableName, value string) error {
+	variable, ok := u.variable(variableName)
+	if !ok {
+		return invalid(variableName, "variable %s is not reported by %s, it can't be set", variableName, u.Name)
+	}
+	if !variable.Writeable {
+		return invalid(variableName, "variable %s of %s is read-only", variableName, u.Name)
+	}
+	if strings.ContainsAny(value, "\r\n\x00") {
+		return invalid(variableName, "value must not contain line breaks or NUL characters")
+	}
+
+	if strings.HasPrefix(variableName, "ups.delay.") {
+		if delay, err := strconv.ParseInt(value, 10, 64); err != nil || delay < 0 {
+			return invalid(variableName, "delay must be a non-negative number of seconds, got %q", value)
+		}
+	}
+
+	switch variable.OriginalType {
+	case "STRING":
+		if variable.MaximumLength > 0 && len(value) > variable.MaximumLength {
+			return invalid(variableName, "value is longer than %d characters", variable.MaximumLength)
+		}
+	case "NUMBER", "RANGE":
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return invalid(variableName, "value must be a number, got %q", value)
+		}
+		if variable.OriginalType != "RANGE" {
+			return nil
+		}
+		ranges, err := u.GetVariableRanges(variableName)
+		if err != nil || len(ranges) == 0 {
+			return nil
+		}
+		for _, r := range ranges {
+			if number >= r[0] && number <= r[1] {
+				return nil
+			}
+		}
+		return invalid(variableName, "value %s is out of the allowed ranges %v", value, ranges)
+	case "ENUM":
+		enums, err := u.GetVariableEnums(variableName)
+		if err != nil || len(enums) == 0 {
+			return nil
+		}
+		if !slices.Contains(enums, value) {
+			return invalid(variableName, "value %q is not one of the allowed values %v", value, enums)
+		}
+	}
+
+	return nil
+}
+
+// ForceShutdown sets the forced shutdown flag on the UPS. The primary status of the UPS
+// (PRIMARY, or MASTER before protocol 1.3) is acquired on the same connection first,
+// which requires the upsmon primary rights for the user.
+func (u *UPS) ForceShutdown() (bool, error) {
+	if !u.Client.allowFSD {
+		return false, fmt.Errorf("forced shutdown is disabled")
+	}
+
+	err := u.withConnection(func(conn *connection) error {
+		cmd := primaryCommand(conn.protocolVersion)
+		resp, err := conn.sendCommand(fmt.Sprintf("%s %s", cmd, u.Name))
+		if err != nil {
+			var nutErr *Error
+			if errors.As(err, &nutErr) && nutErr.Code == "ACCESS-DENIED" {
+				return fmt.Errorf("user %s lacks the upsmon primary rights required for %s: %w", u.Client.username, cmd, err)
+			}
+			return fmt.Errorf("failed to acquire %s status: %w", cmd, err)
+		}
+		if len(resp) == 0 || !strings.HasPrefix(resp[0], "OK") {
+			return fmt.Errorf("%s command failed: %s", cmd, resp)
+		}
+
+		resp, err = conn.sendCommand(fmt.Sprintf("FSD %s", u.Name))
+		if err != nil {
+			return fmt.Errorf("failed to send force shutdown command: %w", err)
+		}
+		if len(resp) == 0 || resp[0] != "OK FSD-SET" {
+			return fmt.Errorf("force shutdown command failed: %s", resp)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
 	}
 	return true, nil
 }
 
+// SetResult - the value requested with SET VAR and the value read back with GET VAR
+type SetResult struct {
+	Requested string
+	// Actual is the value read back, Confirmed is false when it wasn't read
+	Actual    string
+	Confirmed bool
+}
+
+// Applied reports whether the value read back is the requested one, numbers are compared by value.
+// A value not read back is assumed applied.
+func (r SetResult) Applied() bool {
+	if !r.Confirmed || strings.TrimSpace(r.Actual) == strings.TrimSpace(r.Requested) {
+		return true
+	}
+	actual, actualOK := asFloat64(r.Actual)
+	requested, requestedOK := asFloat64(r.Requested)
+	return actualOK && requestedOK && actual == requested
+}
+
+// SetVariable validates the value with ValidateVariable, sets the variable and, with confirm, reads it back.
+// Some drivers accept the value and don't apply it, e.g. on read-only hardware, or clamp it to the range.
+// A failed read back is logged and leaves the result unconfirmed.
+func (u *UPS) SetVariable(variableName, value string, confirm bool) (SetResult, error) {
+	result := SetResult{Requested: value}
+	if err := u.ValidateVariable(variableName, value); err != nil {
+		return result, err
+	}
+	resp, err := u.sendCommand(fmt.Sprintf("SET VAR %s %s %s", u.Name, variableName, quoteField(value)))
+	if err != nil {
+		return result, err
+	}
+	if len(resp) == 0 {
+		return result, fmt.Errorf("failed to set variable %s to %s: %s", variableName, value, resp)
+	}
+	extra, ok := okResponse(resp[0])
+	if !ok {
+		return result, fmt.Errorf("failed to set variable %s to %s: %s", variableName, value, resp)
+	}
+	if extra != "" {
+		log.Printf("[DEBUG] %s: variable %s: %s", u.Name, variableName, extra)
+	}
+	if !confirm {
+		return result, nil
+	}
+
+	current, err := u.GetVariableValue(variableName)
+	if err != nil {
+		log.Printf("[WARN] %s: read %s after set: %v", u.Name, variableName, err)
+		return result, nil
+	}
+	result.Actual, result.Confirmed = fmt.Sprint(current), true
+	return result, nil
+}
+
 func (u *UPS) SendCommand(commandName string) (bool, error) {
-	resp, err := u.Client.sendCommand(fmt.Sprintf("INSTCMD %s %s", u.Name, commandName))
+	resp, err := u.sendCommand(fmt.Sprintf("INSTCMD %s %s", u.Name, commandName))
 	if err != nil {
 		return false, err
 	}
-	if len(resp) == 0 || resp[0] != "OK" {
+	if len(resp) == 0 {
+		return false, fmt.Errorf("failed to send command %s: %s", commandName, resp)
+	}
+	extra, ok := okResponse(resp[0])
+	if !ok {
 		return false, fmt.Errorf("failed to send command %s: %s", commandName, resp)
 	}
+	if extra != "" {
+		log.Printf("[DEBUG] %s: command %s: %s", u.Name, commandName, extra)
+	}
 	return true, nil
 }
 
+// withConnection runs fn on a single connection, for the commands depending on the session state.
+// In the pool mode the connection is checked out for the whole fn.
+func (u *UPS) withConnection(fn func(conn *connection) error) error {
+	if u.restored {
+		return errRestored
+	}
+	if u.conn != nil {
+		return fn(u.conn)
+	}
+	conn, err := u.Client.pool.get()
+	if err != nil {
+		return err
+	}
+	err = fn(conn.connection)
+	u.Client.pool.put(conn, err)
+	return err
+}
+
+// primaryCommand returns the command acquiring the primary status, MASTER was renamed
+// to PRIMARY in the network protocol 1.3 (NUT 2.8.0)
+func primaryCommand(protocolVersion string) string {
+	var major, minor int
+	if _, err := fmt.Sscanf(protocolVersion, "%d.%d", &major, &minor); err != nil {
+		return "PRIMARY"
+	}
+	if major < 1 || (major == 1 && minor < 3) {
+		return "MASTER"
+	}
+	return "PRIMARY"
+}
+
+// sendCommand sends a command over the connection assigned to the UPS or a pooled one,
+// the failed connection is reopened and a retryable command retried once
+func (u *UPS) sendCommand(cmd string) ([]string, error) {
+	if u.restored {
+		return nil, errRestored
+	}
+	if u.conn == nil {
+		return u.Client.pool.do(cmd)
+	}
+	return u.conn.do(cmd)
+}
+
+// streamCommand sends the command and calls fn with each line of the response, see connection.doStream
+func (u *UPS) streamCommand(cmd string, fn func(line string)) error {
+	if u.restored {
+		return errRestored
+	}
+	if u.conn == nil {
+		return u.Client.pool.doStream(cmd, fn)
+	}
+	return u.conn.doStream(cmd, fn)
+}
+
+// reconnect reopens the connection assigned to the UPS. Pooled connections are replaced
+// by the pool itself, so there is nothing to do.
+func (u *UPS) reconnect() error {
+	if u.conn == nil {
+		return nil
+	}
+	if u.conn == u.Client.conn {
+		return u.Client.Reconnect()
+	}
+	return u.conn.dial()
+}
+
+// HasCommand reports whether the UPS supports the instant command
+func (u *UPS) HasCommand(name string) bool {
+	for _, cmd := range u.Commands {
+		if cmd.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsWriteable reports whether the variable exists and can be changed
+func (u *UPS) IsWriteable(name string) bool {
+	variable, ok := u.variable(name)
+	return ok && variable.Writeable
+}
+
+func (u *UPS) variable(name string) (Variable, bool) {
+	for _, variable := range u.CurrentVariables() {
+		if variable.Name == name {
+			return variable, true
+		}
+	}
+	return Variable{}, false
+}
+
+// asInt64 converts the numeric variable value to int64. Values are parsed as int64 or as float64
+// depending on whether the device reported a decimal point, floats are rounded, e.g. ups.load reported as 12.5.
+// Some drivers report numeric variables as text while initializing, e.g. battery.charge is "unknown" in one poll
+// and 85 in the next, the value is converted when it's a number and rejected otherwise.
+func asInt64(value any) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case float64:
+		if r := math.Round(v); r >= math.MinInt64 && r < math.MaxInt64 {
+			return int64(r), true
+		}
+	case string:
+		if i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+			return i, true
+		}
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return asInt64(f)
+		}
+	}
+	return 0, false
+}
+
+// asFloat64 converts the numeric variable value to float64, e.g. battery.voltage reported as 27
+func asFloat64(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return f, true
+		}
+	}
+	return 0, false
+}
+
+// StringVar returns the value of the variable as reported by the server, also for numeric
+// and boolean variables, e.g. a serial number that looks like a number
+func (u *UPS) StringVar(name string) (string, bool) {
+	variable, ok := u.variable(name)
+	return variable.Raw, ok
+}
+
+// IntVar returns the value of the numeric variable, floats are accepted when they have no fraction
+func (u *UPS) IntVar(name string) (int64, bool) {
+	return asInt64(u.getVariable(name))
+}
+
+// FloatVar returns the value of the numeric variable, integers are converted to float
+func (u *UPS) FloatVar(name string) (float64, bool) {
+	return asFloat64(u.getVariable(name))
+}
+
+// BoolVar returns the value of the boolean variable, e.g. enabled/disabled values
+func (u *UPS) BoolVar(name string) (bool, bool) {
+	value, ok := u.getVariable(name).(bool)
+	return value, ok
+}
+
 func (u *UPS) getVariable(name string) any {
-	for _, variable := range u.Variables {
+	for _, variable := range u.CurrentVariables() {
 		if variable.Name == name {
 			return variable.Value
 		}
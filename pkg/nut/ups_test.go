@@ -0,0 +1,467 @@
+package nut
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeableDevice returns a device with the writeable string ups.id and the read-only ups.status
+func writeableDevice() *fakeDevice {
+	return &fakeDevice{
+		Name:  "ups",
+		Desc:  "Test UPS",
+		Vars:  map[string]string{"ups.id": "rack", "ups.status": "OL", "ups.delay.shutdown": "20"},
+		Types: map[string]string{"ups.id": "RW STRING:32", "ups.status": "STRING:16", "ups.delay.shutdown": "RW NUMBER"},
+	}
+}
+
+func TestSetVariableEscapesValue(t *testing.T) {
+	server := newFakeUPSD(t, writeableDevice())
+	ups := server.ups(t, server.client(t, Config{}), "ups")
+
+	value := `He said "hi" \o/`
+	result, err := ups.SetVariable("ups.id", value, true)
+	if err != nil {
+		t.Fatalf("SetVariable: %v", err)
+	}
+	want := `SET VAR ups ups.id "He said \"hi\" \\o/"`
+	if !slices.Contains(server.commands(), want) {
+		t.Errorf("command %s not sent, got %q", want, server.commands())
+	}
+	if !result.Confirmed || !result.Applied() {
+		t.Errorf("value not read back: %+v", result)
+	}
+}
+
+func TestSetVariableRejectsLineBreaks(t *testing.T) {
+	server := newFakeUPSD(t, writeableDevice())
+	ups := server.ups(t, server.client(t, Config{}), "ups")
+
+	for _, value := range []string{"rack\nFSD ups", "rack\r\nFSD ups", "rack\rFSD ups", "rack\x00"} {
+		_, err := ups.SetVariable("ups.id", value, false)
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) {
+			t.Errorf("SetVariable(%q) error = %v, want *ValidationError", value, err)
+		}
+	}
+	for _, cmd := range server.commands() {
+		if strings.HasPrefix(cmd, "SET ") || strings.HasPrefix(cmd, "FSD ") {
+			t.Errorf("command %q sent", cmd)
+		}
+	}
+}
+
+func TestPollStopsRemovedUPS(t *testing.T) {
+	server := newFakeUPSD(t, writeableDevice())
+	ups := server.ups(t, server.client(t, Config{}), "ups")
+
+	stop := readConcurrently(func() { _ = ups.Gone() })
+	server.update(func(s *fakeUPSD) { s.devices = nil })
+	if !ups.PollIfOlder(0) {
+		t.Fatal("UPS not polled")
+	}
+	if !ups.Gone() {
+		t.Fatal("UPS not gone after UNKNOWN-UPS")
+	}
+	stop()
+
+	// a second stop, e.g. by the update of the list after a reconnect, is ignored
+	ups.stop()
+	if ups.PollIfOlder(0) {
+		t.Error("gone UPS polled")
+	}
+}
+
+func TestPollFailures(t *testing.T) {
+	server := newFakeUPSD(t, writeableDevice())
+	ups := server.ups(t, server.client(t, Config{}), "ups")
+
+	stop := readConcurrently(func() {
+		_ = ups.Failures()
+		_ = ups.Reconnecting()
+	})
+
+	server.setHandler(func(line string) ([]string, bool) {
+		if strings.HasPrefix(line, "LIST VAR ") {
+			return []string{"ERR DATA-STALE"}, true
+		}
+		return nil, false
+	})
+	ups.PollIfOlder(0)
+	ups.PollIfOlder(0)
+	failures := ups.Failures()
+	if failures.Consecutive != 2 || failures.Total != 2 || !strings.HasSuffix(failures.LastError, "DATA-STALE") || failures.LastFailure.IsZero() {
+		t.Errorf("failures after 2 failed polls = %+v", failures)
+	}
+	if !ups.Reconnecting() {
+		t.Error("not reconnecting after failed polls")
+	}
+
+	server.setHandler(nil)
+	ups.PollIfOlder(0)
+	stop()
+	failures = ups.Failures()
+	if failures.Consecutive != 0 || failures.Total != 2 || !strings.HasSuffix(failures.LastError, "DATA-STALE") {
+		t.Errorf("failures after a successful poll = %+v", failures)
+	}
+	if ups.Reconnecting() {
+		t.Error("reconnecting after a successful poll")
+	}
+}
+
+func TestPollConcurrentWithReads(t *testing.T) {
+	device := writeableDevice()
+	device.Clients = []string{"192.168.1.2"}
+	server := newFakeUPSD(t, device)
+	ups := server.ups(t, server.client(t, Config{Poll: PollConfig{Interval: time.Millisecond}}), "ups")
+
+	deadline := time.Now().Add(200 * time.Millisecond)
+	done := make(chan struct{})
+	for range 4 {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for time.Now().Before(deadline) {
+				ups.PollIfOlder(0)
+				if len(ups.CurrentVariables()) == 0 || len(ups.ConnectedClients()) != 1 || ups.Updated().IsZero() {
+					t.Error("variables or clients missing while polling")
+					return
+				}
+				_ = ups.Healthy()
+				_ = ups.Expired()
+				_ = ups.GetOutlets()
+				_ = ups.GetDriver()
+			}
+		}()
+	}
+	for range 4 {
+		<-done
+	}
+}
+
+func TestGetBatteryVoltage(t *testing.T) {
+	tests := []struct {
+		voltage, nominal, packs string
+		value, scale            float64
+	}{
+		{voltage: "27.1", nominal: "24", value: 27.1, scale: 1},
+		{voltage: "2.3", nominal: "24", value: 23, scale: 10},
+		{voltage: "271", nominal: "24", value: 27.1, scale: 0.1},
+		{voltage: "13.6", nominal: "48", packs: "4", value: 54.4, scale: 4},
+		{voltage: "13.6", nominal: "12", value: 13.6, scale: 1},
+		{voltage: "27.1", value: 27.1, scale: 1},
+	}
+	for _, tt := range tests {
+		device := &fakeDevice{Name: "ups", Vars: map[string]string{"ups.status": "OL", "battery.voltage": tt.voltage}}
+		if tt.nominal != "" {
+			device.Vars["battery.voltage.nominal"] = tt.nominal
+		}
+		if tt.packs != "" {
+			device.Vars["battery.packs"] = tt.packs
+		}
+		server := newFakeUPSD(t, device)
+		ups := server.ups(t, server.client(t, Config{}), "ups")
+
+		// the handlers read the voltage while the poll does
+		results := make(chan BatteryVoltage, 4)
+		for range 4 {
+			go func() { results <- ups.GetBatteryVoltage() }()
+		}
+		for range 4 {
+			v := <-results
+			if v.Value != tt.value || v.Scale != tt.scale {
+				t.Errorf("GetBatteryVoltage(%s, nominal %s) = %gV scale %g, want %gV scale %g",
+					tt.voltage, tt.nominal, v.Value, v.Scale, tt.value, tt.scale)
+			}
+		}
+	}
+}
+
+func TestDebouncedStatus(t *testing.T) {
+	device := &fakeDevice{Name: "ups", Vars: map[string]string{"ups.status": "OL"}}
+	server := newFakeUPSD(t, device)
+	ups := server.ups(t, server.client(t, Config{OnBatteryDelay: 50 * time.Millisecond}), "ups")
+	ups.PollIfOlder(0)
+
+	defer readConcurrently(func() { _ = ups.DebouncedStatus() })()
+
+	server.update(func(s *fakeUPSD) { device.Vars["ups.status"] = "OB DISCHRG" })
+	ups.PollIfOlder(0)
+	if status := ups.DebouncedStatus(); status != "OL" {
+		t.Errorf("status of a brief dropout = %s, want OL", status)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if status := ups.DebouncedStatus(); status != "OB DISCHRG" {
+		t.Errorf("status after the delay = %s, want OB DISCHRG", status)
+	}
+
+	server.update(func(s *fakeUPSD) { device.Vars["ups.status"] = "OL CHRG" })
+	ups.PollIfOlder(0)
+	if status := ups.DebouncedStatus(); status != "OL CHRG" {
+		t.Errorf("status back on line = %s, want OL CHRG", status)
+	}
+}
+
+func TestSkipActionReconnectsAfterTimeoutsOnly(t *testing.T) {
+	server := newFakeUPSD(t, writeableDevice())
+	cfg := Config{Poll: PollConfig{Timeout: 50 * time.Millisecond, TimeoutAction: PollTimeoutSkip, ReconnectAfter: 1}}
+	ups := server.ups(t, server.client(t, cfg), "ups")
+
+	server.setHandler(func(line string) ([]string, bool) {
+		if strings.HasPrefix(line, "LIST VAR ") {
+			return []string{"ERR DATA-STALE"}, true
+		}
+		return nil, false
+	})
+	ups.PollIfOlder(0)
+	ups.PollIfOlder(0)
+	if n := count(server.commands(), "USERNAME "); n != 1 {
+		t.Errorf("%d connections after the server errors, want 1", n)
+	}
+
+	server.setHandler(func(line string) ([]string, bool) {
+		if strings.HasPrefix(line, "LIST VAR ") {
+			time.Sleep(100 * time.Millisecond)
+		}
+		return nil, false
+	})
+	ups.PollIfOlder(0)
+	if n := count(server.commands(), "USERNAME "); n != 2 {
+		t.Errorf("%d connections after the timeout, want 2", n)
+	}
+}
+
+func TestDescriptionsWithQuotes(t *testing.T) {
+	device := writeableDevice()
+	device.Desc = `Rack "A" \ server room`
+	device.Cmds = []string{"beeper.mute"}
+	server := newFakeUPSD(t, device)
+	server.setHandler(func(line string) ([]string, bool) {
+		switch {
+		case strings.HasPrefix(line, "GET DESC ups ups.id"):
+			return []string{`DESC ups ups.id "Id of the \"UPS\", e.g. C:\\ups"`}, true
+		case strings.HasPrefix(line, "GET CMDDESC ups beeper.mute"):
+			return []string{`CMDDESC ups beeper.mute "Mute the \"beeper\""`}, true
+		}
+		return nil, false
+	})
+	ups := server.ups(t, server.client(t, Config{}), "ups")
+
+	if description, err := ups.GetDescription(); err != nil || description != device.Desc {
+		t.Errorf("GetDescription = %q, %v, want %q", description, err, device.Desc)
+	}
+	if description, err := ups.GetVariableDescription("ups.id"); err != nil || description != `Id of the "UPS", e.g. C:\ups` {
+		t.Errorf("GetVariableDescription = %q, %v", description, err)
+	}
+	if description, err := ups.GetCommandDescription("beeper.mute"); err != nil || description != `Mute the "beeper"` {
+		t.Errorf("GetCommandDescription = %q, %v", description, err)
+	}
+}
+
+func TestVariableValueWithQuotes(t *testing.T) {
+	device := writeableDevice()
+	device.Vars["ups.id"] = `He said "hi" \o/`
+	server := newFakeUPSD(t, device)
+	ups := server.ups(t, server.client(t, Config{}), "ups")
+
+	i := slices.IndexFunc(ups.CurrentVariables(), func(v Variable) bool { return v.Name == "ups.id" })
+	if i == -1 || ups.CurrentVariables()[i].Value != device.Vars["ups.id"] {
+		t.Errorf("ups.id of LIST VAR not %q: %+v", device.Vars["ups.id"], ups.CurrentVariables())
+	}
+	if value, err := ups.GetVariableValue("ups.id"); err != nil || value != device.Vars["ups.id"] {
+		t.Errorf("GetVariableValue = %q, %v, want %q", value, err, device.Vars["ups.id"])
+	}
+}
+
+func TestSendCommandResponses(t *testing.T) {
+	tests := []struct {
+		response string
+		ok       bool
+		code     string
+	}{
+		{response: "OK", ok: true},
+		{response: "OK TRACKING 1bd31808-cb49-4aec-9d75-d056e6f018d2", ok: true},
+		{response: "ERR CMD-NOT-SUPPORTED", code: "CMD-NOT-SUPPORTED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.response, func(t *testing.T) {
+			device := writeableDevice()
+			device.Cmds = []string{"beeper.mute"}
+			server := newFakeUPSD(t, device)
+			ups := server.ups(t, server.client(t, Config{}), "ups")
+			server.setHandler(func(line string) ([]string, bool) {
+				if strings.HasPrefix(line, "INSTCMD ") || strings.HasPrefix(line, "SET VAR ") {
+					return []string{tt.response}, true
+				}
+				return nil, false
+			})
+
+			ok, err := ups.SendCommand("beeper.mute")
+			if ok != tt.ok || (tt.code == "") != (err == nil) || (tt.code != "" && !isErrorCode(err, tt.code)) {
+				t.Errorf("SendCommand = %v, %v, want %v %s", ok, err, tt.ok, tt.code)
+			}
+			_, err = ups.SetVariable("ups.id", "rack 2", false)
+			if (tt.code == "") != (err == nil) || (tt.code != "" && !isErrorCode(err, tt.code)) {
+				t.Errorf("SetVariable error = %v, want %s", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestVariableWithoutType(t *testing.T) {
+	for _, pipeline := range []bool{false, true} {
+		t.Run(fmt.Sprintf("pipeline %v", pipeline), func(t *testing.T) {
+			device := writeableDevice()
+			device.Vars["battery.charge"] = "85"
+			server := newFakeUPSD(t, device)
+			server.setHandler(func(line string) ([]string, bool) {
+				if line == "GET TYPE ups battery.charge" {
+					return []string{"ERR VAR-NOT-SUPPORTED"}, true
+				}
+				return nil, false
+			})
+			ups := server.ups(t, server.client(t, Config{Pipeline: pipeline}), "ups")
+
+			if failures := ups.Failures(); failures.Total != 0 {
+				t.Fatalf("poll failed: %+v", failures)
+			}
+			variables := ups.CurrentVariables()
+			i := slices.IndexFunc(variables, func(v Variable) bool { return v.Name == "battery.charge" })
+			if i == -1 {
+				t.Fatalf("battery.charge missing: %+v", variables)
+			}
+			if variables[i].OriginalType != "UNKNOWN" || variables[i].Type != "INTEGER" || variables[i].Writeable {
+				t.Errorf("battery.charge = %+v, want a read-only INTEGER inferred from the value", variables[i])
+			}
+			if charge, ok := ups.IntVar("battery.charge"); !ok || charge != 85 {
+				t.Errorf("battery.charge = %d, %v, want 85 inferred from the value", charge, ok)
+			}
+			i = slices.IndexFunc(variables, func(v Variable) bool { return v.Name == "ups.id" })
+			if i == -1 || !variables[i].Writeable {
+				t.Errorf("ups.id not typed: %+v", variables)
+			}
+		})
+	}
+}
+
+func TestGetBatteryChangingType(t *testing.T) {
+	device := &fakeDevice{Name: "ups", Vars: map[string]string{"ups.status": "OL", "battery.charge": "unknown", "battery.charge.low": "10"}}
+	server := newFakeUPSD(t, device)
+	ups := server.ups(t, server.client(t, Config{}), "ups")
+
+	for _, tt := range []struct {
+		value  string
+		charge int64
+		ok     bool
+	}{
+		{value: "unknown", charge: 0},
+		{value: "85", charge: 85, ok: true},
+		{value: "85.0", charge: 85, ok: true},
+		{value: "84.6", charge: 85, ok: true},
+		{value: "unknown", charge: 0},
+	} {
+		server.update(func(s *fakeUPSD) { device.Vars["battery.charge"] = tt.value })
+		if !ups.PollIfOlder(0) {
+			t.Fatal("UPS not polled")
+		}
+		if value, ok := ups.IntVar("battery.charge"); value != tt.charge || ok != tt.ok {
+			t.Errorf("IntVar(battery.charge) of %q = %d, %v, want %d, %v", tt.value, value, ok, tt.charge, tt.ok)
+		}
+		charge, low, _, err := ups.GetBattery()
+		if err != nil || charge != tt.charge || low != 10 {
+			t.Errorf("GetBattery of %q = %d, %d, %v, want %d and 10", tt.value, charge, low, err, tt.charge)
+		}
+	}
+}
+
+func TestGetLoadFractional(t *testing.T) {
+	device := &fakeDevice{Name: "ups", Vars: map[string]string{"ups.status": "OL", "ups.load": "12.5"}}
+	server := newFakeUPSD(t, device)
+	ups := server.ups(t, server.client(t, Config{}), "ups")
+
+	load, _, err := ups.GetLoad()
+	if err != nil || load != 13 {
+		t.Errorf("GetLoad = %d, %v, want 13", load, err)
+	}
+}
+
+func TestValidateVariable(t *testing.T) {
+	server := newFakeUPSD(t, writeableDevice())
+	ups := server.ups(t, server.client(t, Config{}), "ups")
+
+	tests := []struct {
+		name  string
+		value string
+		err   string
+	}{
+		{name: "ups.id", value: "rack 2"},
+		{name: "ups.delay.shutdown", value: "30"},
+		{name: "ups.status", value: "OB", err: "read-only"},
+		{name: "ups.unknown", value: "1", err: "not reported"},
+		{name: "ups.id", value: strings.Repeat("x", 33), err: "longer than 32 characters"},
+		{name: "ups.delay.shutdown", value: "-1", err: "non-negative number of seconds"},
+		{name: "ups.delay.shutdown", value: "soon", err: "non-negative number of seconds"},
+	}
+	for _, tt := range tests {
+		err := ups.ValidateVariable(tt.name, tt.value)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("ValidateVariable(%s, %q) = %v, want no error", tt.name, tt.value, err)
+			}
+			continue
+		}
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("ValidateVariable(%s, %q) = %v, want *ValidationError %s", tt.name, tt.value, err, tt.err)
+		}
+		if _, err := ups.SetVariable(tt.name, tt.value, false); !errors.As(err, &validationErr) {
+			t.Errorf("SetVariable(%s, %q) = %v, want *ValidationError", tt.name, tt.value, err)
+		}
+	}
+	if n := count(server.commands(), "SET VAR "); n != 0 {
+		t.Errorf("SET VAR sent %d times for the invalid values", n)
+	}
+}
+
+func TestRoleRequestedByPoll(t *testing.T) {
+	server := newFakeUPSD(t, writeableDevice())
+	server.setHandler(func(line string) ([]string, bool) {
+		if line == "PRIMARY ups" {
+			return []string{"OK"}, true
+		}
+		return nil, false
+	})
+	// the role doesn't depend on the metadata refresh, 0 refreshes the metadata in every poll
+	ups := server.ups(t, server.client(t, Config{AllowFSD: true}), "ups")
+
+	// the handlers only read the cached role, nothing is sent to the server
+	sent := count(server.commands(), "PRIMARY ")
+	for range 3 {
+		_ = ups.GetRole()
+	}
+	if n := count(server.commands(), "PRIMARY ") - sent; n != 0 {
+		t.Errorf("GetRole sent PRIMARY %d times, want none", n)
+	}
+
+	ups.PollIfOlder(0)
+	if role := ups.GetRole(); role != RolePrimary {
+		t.Errorf("role after the poll = %s, want %s", role, RolePrimary)
+	}
+	ups.PollIfOlder(0)
+	if n := count(server.commands(), "PRIMARY "); n != 1 {
+		t.Errorf("PRIMARY sent %d times on the same connection, want 1", n)
+	}
+
+	// the primary status ended with the session, it's requested again on the new connection
+	server.dropConnections()
+	ups.PollIfOlder(0)
+	if n := count(server.commands(), "PRIMARY "); n != 2 {
+		t.Errorf("PRIMARY sent %d times after the reconnect, want 2", n)
+	}
+	if role := ups.GetRole(); role != RolePrimary {
+		t.Errorf("role after the reconnect = %s, want %s", role, RolePrimary)
+	}
+}
@@ -0,0 +1,300 @@
+package nut
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDevice - the UPS of the fake upsd, the variables are NUMBER unless typed otherwise
+type fakeDevice struct {
+	Name    string
+	Desc    string
+	Vars    map[string]string
+	Types   map[string]string
+	Ranges  map[string][][2]string
+	Enums   map[string][]string
+	Cmds    []string
+	Clients []string
+}
+
+// fakeUPSD - upsd of the tests speaking the NUT network protocol on a local port. The commands are answered
+// from the devices, handle answers them first when set. Responses are terminated with lineEnd.
+type fakeUPSD struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	devices  []*fakeDevice
+	handle   func(line string) ([]string, bool)
+	lineEnd  string
+	received []string
+	conns    []net.Conn
+}
+
+// newFakeUPSD starts the upsd with the devices, it's stopped with the test
+func newFakeUPSD(t *testing.T, devices ...*fakeDevice) *fakeUPSD {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &fakeUPSD{listener: listener, devices: devices, lineEnd: "\n"}
+	t.Cleanup(func() {
+		_ = listener.Close()
+		s.dropConnections()
+	})
+	go s.serve()
+	return s
+}
+
+func (s *fakeUPSD) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+		go s.session(conn)
+	}
+}
+
+// session answers the commands of the connection until it's closed, a nil response closes it
+func (s *fakeUPSD) session(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := scanner.Text()
+		s.mu.Lock()
+		s.received = append(s.received, line)
+		handle, lineEnd := s.handle, s.lineEnd
+		s.mu.Unlock()
+
+		resp, ok := []string(nil), false
+		if handle != nil {
+			resp, ok = handle(line)
+		}
+		if !ok {
+			s.mu.Lock()
+			resp = s.answer(line)
+			s.mu.Unlock()
+		}
+		if resp == nil {
+			return
+		}
+		var b strings.Builder
+		for _, l := range resp {
+			b.WriteString(l + lineEnd)
+		}
+		if _, err := conn.Write([]byte(b.String())); err != nil {
+			return
+		}
+	}
+}
+
+// answer returns the response of the devices to the command, the caller must hold the lock
+func (s *fakeUPSD) answer(line string) []string {
+	fields, err := splitFields(line)
+	if err != nil || len(fields) == 0 {
+		return []string{"ERR INVALID-ARGUMENT"}
+	}
+	arg := func(i int) string {
+		if i < len(fields) {
+			return fields[i]
+		}
+		return ""
+	}
+	switch fields[0] {
+	case "USERNAME", "PASSWORD", "LOGIN":
+		return []string{"OK"}
+	case "VER":
+		return []string{"Network UPS Tools upsd 2.8.1 - https://www.networkupstools.org/"}
+	case "NETVER":
+		return []string{"1.3"}
+	case "LOGOUT":
+		return []string{"OK Goodbye"}
+	}
+
+	if fields[0] == "LIST" && arg(1) == "UPS" {
+		resp := []string{"BEGIN LIST UPS"}
+		for _, d := range s.devices {
+			resp = append(resp, fmt.Sprintf("UPS %s %s", d.Name, fakeQuote(d.Desc)))
+		}
+		return append(resp, "END LIST UPS")
+	}
+	var d *fakeDevice
+	for _, device := range s.devices {
+		if device.Name == arg(2) || (fields[0] == "INSTCMD" || fields[0] == "FSD") && device.Name == arg(1) {
+			d = device
+		}
+	}
+	if d == nil {
+		return []string{"ERR UNKNOWN-UPS"}
+	}
+
+	name, variable := d.Name, arg(3)
+	switch fields[0] + " " + arg(1) {
+	case "LIST VAR":
+		resp := []string{"BEGIN LIST VAR " + name}
+		for k, v := range d.Vars {
+			resp = append(resp, fmt.Sprintf("VAR %s %s %s", name, k, fakeQuote(v)))
+		}
+		return append(resp, "END LIST VAR "+name)
+	case "LIST CMD":
+		resp := []string{"BEGIN LIST CMD " + name}
+		for _, cmd := range d.Cmds {
+			resp = append(resp, fmt.Sprintf("CMD %s %s", name, cmd))
+		}
+		return append(resp, "END LIST CMD "+name)
+	case "LIST CLIENT":
+		resp := []string{"BEGIN LIST CLIENT " + name}
+		for _, client := range d.Clients {
+			resp = append(resp, fmt.Sprintf("CLIENT %s %s", name, client))
+		}
+		return append(resp, "END LIST CLIENT "+name)
+	case "LIST RANGE":
+		resp := []string{fmt.Sprintf("BEGIN LIST RANGE %s %s", name, variable)}
+		for _, r := range d.Ranges[variable] {
+			resp = append(resp, fmt.Sprintf("RANGE %s %s %s %s", name, variable, fakeQuote(r[0]), fakeQuote(r[1])))
+		}
+		return append(resp, fmt.Sprintf("END LIST RANGE %s %s", name, variable))
+	case "LIST ENUM":
+		resp := []string{fmt.Sprintf("BEGIN LIST ENUM %s %s", name, variable)}
+		for _, e := range d.Enums[variable] {
+			resp = append(resp, fmt.Sprintf("ENUM %s %s %s", name, variable, fakeQuote(e)))
+		}
+		return append(resp, fmt.Sprintf("END LIST ENUM %s %s", name, variable))
+	case "GET UPSDESC":
+		return []string{fmt.Sprintf("UPSDESC %s %s", name, fakeQuote(d.Desc))}
+	case "GET NUMLOGINS":
+		return []string{fmt.Sprintf("NUMLOGINS %s %d", name, len(d.Clients))}
+	case "GET VAR":
+		value, ok := d.Vars[variable]
+		if !ok {
+			return []string{"ERR VAR-NOT-SUPPORTED"}
+		}
+		return []string{fmt.Sprintf("VAR %s %s %s", name, variable, fakeQuote(value))}
+	case "GET DESC":
+		return []string{fmt.Sprintf("DESC %s %s %s", name, variable, fakeQuote("Description of "+variable))}
+	case "GET CMDDESC":
+		return []string{fmt.Sprintf("CMDDESC %s %s %s", name, variable, fakeQuote("Command "+variable))}
+	case "GET TYPE":
+		if _, ok := d.Vars[variable]; !ok {
+			return []string{"ERR VAR-NOT-SUPPORTED"}
+		}
+		typ, ok := d.Types[variable]
+		if !ok {
+			typ = "NUMBER"
+		}
+		return []string{fmt.Sprintf("TYPE %s %s %s", name, variable, typ)}
+	case "SET VAR":
+		if _, ok := d.Vars[variable]; !ok {
+			return []string{"ERR VAR-NOT-SUPPORTED"}
+		}
+		d.Vars[variable] = arg(4)
+		return []string{"OK"}
+	}
+	if fields[0] == "INSTCMD" || fields[0] == "FSD" {
+		return []string{"OK"}
+	}
+	return []string{"ERR UNKNOWN-COMMAND"}
+}
+
+// fakeQuote quotes the value like upsd, escaping the backslashes and the double quotes
+func fakeQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// setHandler answers the commands with fn first, the devices answer the commands fn doesn't
+func (s *fakeUPSD) setHandler(fn func(line string) ([]string, bool)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handle = fn
+}
+
+// update changes the devices while holding the lock of the server
+func (s *fakeUPSD) update(fn func(s *fakeUPSD)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s)
+}
+
+// commands returns the commands received so far
+func (s *fakeUPSD) commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.received...)
+}
+
+// dropConnections closes the open connections, the clients reconnect
+func (s *fakeUPSD) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.conns = nil
+}
+
+// client connects to the server with the config, without polling unless configured
+func (s *fakeUPSD) client(t *testing.T, cfg Config) *Client {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	cfg.Hostname, cfg.Port = host, port
+	if cfg.Poll.Interval == 0 {
+		cfg.Poll.Interval = time.Hour
+		cfg.DisablePolling = true
+	}
+	if cfg.Poll.Timeout == 0 {
+		cfg.Poll.Timeout = time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	client, err := New(ctx, cfg)
+	if err != nil {
+		cancel()
+		t.Fatalf("connect to the fake upsd: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		_ = client.Disconnect()
+	})
+	return client
+}
+
+// ups returns the UPS of the client by name
+func (s *fakeUPSD) ups(t *testing.T, client *Client, name string) *UPS {
+	t.Helper()
+	ups := client.byName(name)
+	if ups == nil {
+		t.Fatalf("UPS %s not found", name)
+	}
+	return ups
+}
+
+// readConcurrently calls read repeatedly in another goroutine, like the handlers reading the UPS
+// while it's polled, until the returned stop is called
+func readConcurrently(read func()) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(100 * time.Microsecond):
+				read()
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
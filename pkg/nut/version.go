@@ -0,0 +1,50 @@
+package nut
+
+import (
+	"regexp"
+	"strings"
+)
+
+// versionNumber matches a version like 2.8.1, 2.8.0.1 or 2.8.2.1-39-gb8c7ee8 of the development builds,
+// upsdVersion the version right after "upsd" as in "Network UPS Tools upsd 2.8.1 - http://www.networkupstools.org/"
+var (
+	versionNumber = regexp.MustCompile(`\d+(?:\.\d+)+(?:[-+~][0-9A-Za-z.+~-]*[0-9A-Za-z])?`)
+	upsdVersion   = regexp.MustCompile(`upsd\s+v?(` + versionNumber.String() + `)`)
+)
+
+// protocolNumber matches a protocol version like 1.3
+var protocolNumber = regexp.MustCompile(`\d+\.\d+`)
+
+// parseServerVersion returns the version number from the response to VER, e.g. 2.8.1 from
+// "Network UPS Tools upsd 2.8.1 - http://www.networkupstools.org/". The number after "upsd" is preferred,
+// otherwise the first number of the last line having one, a banner of some servers precedes the version line.
+// False when there is no number.
+func parseServerVersion(resp []string) (string, bool) {
+	for _, line := range resp {
+		if m := upsdVersion.FindStringSubmatch(line); m != nil {
+			return m[1], true
+		}
+	}
+	for i := len(resp) - 1; i >= 0; i-- {
+		if v := versionNumber.FindString(resp[i]); v != "" {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// parseProtocolVersion returns the version number from the response to NETVER, e.g. 1.3 from "1.3"
+// or "Network protocol version 1.3". False when there is no number.
+func parseProtocolVersion(resp []string) (string, bool) {
+	for _, line := range resp {
+		if v := protocolNumber.FindString(line); v != "" {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// banner joins the lines of the response, kept for the logs and the support of unusual servers
+func banner(resp []string) string {
+	return strings.TrimSpace(strings.Join(resp, " "))
+}
@@ -0,0 +1,56 @@
+package nut
+
+import "testing"
+
+func TestParseServerVersion(t *testing.T) {
+	tests := []struct {
+		resp []string
+		want string
+		ok   bool
+	}{
+		{resp: []string{"Network UPS Tools upsd 2.4.3 - http://www.networkupstools.org/"}, want: "2.4.3", ok: true},
+		{resp: []string{"Network UPS Tools upsd 2.6.5 - http://www.networkupstools.org/"}, want: "2.6.5", ok: true},
+		{resp: []string{"Network UPS Tools upsd 2.7.4 - http://www.networkupstools.org/"}, want: "2.7.4", ok: true},
+		{resp: []string{"Network UPS Tools upsd 2.8.0 - https://www.networkupstools.org/"}, want: "2.8.0", ok: true},
+		{resp: []string{"Network UPS Tools upsd 2.8.1 - https://www.networkupstools.org/"}, want: "2.8.1", ok: true},
+		{resp: []string{"Network UPS Tools upsd 2.8.0.1 - https://www.networkupstools.org/"}, want: "2.8.0.1", ok: true},
+		{resp: []string{"Network UPS Tools upsd 2.8.2.1-39-gb8c7ee8 - https://www.networkupstools.org/"}, want: "2.8.2.1-39-gb8c7ee8", ok: true},
+		{resp: []string{"Network UPS Tools upsd v2.8.2-signed - https://www.networkupstools.org/"}, want: "2.8.2-signed", ok: true},
+		{resp: []string{"Network UPS Tools upsd 2.8.1 (development iteration after 2.8.0) - https://www.networkupstools.org/"}, want: "2.8.1", ok: true},
+		// a banner of the distribution precedes the version line
+		{resp: []string{"Welcome to Synology DSM 7.2", "Network UPS Tools upsd 2.7.4 - http://www.networkupstools.org/"}, want: "2.7.4", ok: true},
+		{resp: []string{"Welcome to ups-gateway 1.0", "NUT 2.8.0"}, want: "2.8.0", ok: true},
+		{resp: []string{"2.7.4"}, want: "2.7.4", ok: true},
+		{resp: []string{"Network UPS Tools upsd - https://www.networkupstools.org/"}},
+		{resp: []string{""}},
+		{resp: nil},
+	}
+	for _, tt := range tests {
+		got, ok := parseServerVersion(tt.resp)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseServerVersion(%q) = %q, %v, want %q, %v", tt.resp, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseProtocolVersion(t *testing.T) {
+	tests := []struct {
+		resp []string
+		want string
+		ok   bool
+	}{
+		{resp: []string{"1.0"}, want: "1.0", ok: true},
+		{resp: []string{"1.2"}, want: "1.2", ok: true},
+		{resp: []string{"1.3"}, want: "1.3", ok: true},
+		{resp: []string{"Network protocol version 1.3"}, want: "1.3", ok: true},
+		{resp: []string{"Welcome", "1.3"}, want: "1.3", ok: true},
+		{resp: []string{"unknown"}},
+		{resp: nil},
+	}
+	for _, tt := range tests {
+		got, ok := parseProtocolVersion(tt.resp)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseProtocolVersion(%q) = %q, %v, want %q, %v", tt.resp, got, ok, tt.want, tt.ok)
+		}
+	}
+}
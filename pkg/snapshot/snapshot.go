@@ -0,0 +1,121 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"nutshell/pkg/nut"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// version of the file format, a file of another version is ignored
+const version = 1
+
+type file struct {
+	Version int            `json:"version"`
+	Saved   time.Time      `json:"saved"`
+	UPSs    []nut.Snapshot `json:"upss"`
+}
+
+// Store saves the last known state of the UPSs to the file every Interval and on shutdown, and loads it
+// at the start, the UI shows the last known values until the UPSs are read again
+type Store struct {
+	Path     string
+	Interval time.Duration
+	Clients  []*nut.Client
+
+	// loaded are the snapshots of the file at the start
+	loaded []nut.Snapshot
+}
+
+// Load returns the snapshots of the file, none when the file doesn't exist yet
+func (s *Store) Load() ([]nut.Snapshot, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse snapshot %s: %w", s.Path, err)
+	}
+	if f.Version != version {
+		log.Printf("[WARN] snapshot %s has the version %d, expected %d, ignored", s.Path, f.Version, version)
+		return nil, nil
+	}
+	log.Printf("[INFO] loaded the snapshot of %d UPSs saved at %s", len(f.UPSs), f.Saved.Format(time.DateTime))
+	s.loaded = f.UPSs
+	return f.UPSs, nil
+}
+
+// Save writes the snapshots of the UPSs of the servers, the file is replaced atomically. The UPSs of the servers
+// not connected since the start are kept from the loaded snapshot, the removed UPSs are dropped.
+func (s *Store) Save() error {
+	f := file{Version: version, Saved: time.Now()}
+	servers := map[string]bool{}
+	for _, client := range s.Clients {
+		upss, err := client.UPSs()
+		if err != nil {
+			continue
+		}
+		for _, u := range upss {
+			if u.Gone() || len(u.LastVariables()) == 0 {
+				continue
+			}
+			servers[u.Server] = true
+			f.UPSs = append(f.UPSs, u.Snapshot())
+		}
+	}
+	for _, snapshot := range s.loaded {
+		if !servers[snapshot.Server] {
+			f.UPSs = append(f.UPSs, snapshot)
+		}
+	}
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".*")
+	if err != nil {
+		return fmt.Errorf("create snapshot: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.Path); err != nil {
+		return fmt.Errorf("replace snapshot: %w", err)
+	}
+	log.Printf("[DEBUG] saved the snapshot of %d UPSs to %s", len(f.UPSs), s.Path)
+	return nil
+}
+
+// Run saves the snapshot every Interval until the context is canceled, the snapshot on shutdown is saved by the caller
+func (s *Store) Run(ctx context.Context) {
+	if s.Interval <= 0 {
+		return
+	}
+	tk := time.NewTicker(s.Interval)
+	defer tk.Stop()
+	for {
+		select {
+		case <-tk.C:
+			if err := s.Save(); err != nil {
+				log.Printf("[WARN] %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
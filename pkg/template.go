@@ -2,12 +2,15 @@ package pkg
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"html/template"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"time"
 )
 
@@ -18,12 +21,22 @@ type Template struct {
 	List     *template.Template
 	Details  *template.Template
 	NotFound *template.Template
+	Compare  *template.Template
+
+	Dependencies *template.Template
+
+	// ScriptHashes are the CSP sources ('sha256-...') of the inline scripts in the templates
+	ScriptHashes []string
+
+	// Err is the error of the last templates load, nil when templates are loaded
+	Err error
 }
 
+var inlineScript = regexp.MustCompile(`(?s)<script>(.*?)</script>`)
+
 func (t *Template) Run(ctx context.Context) error {
-	if err := t.loadTemplates(); err != nil {
-		return fmt.Errorf("load templates: %w", err)
-	}
+	// keep watching for changes when templates fail to load, so a fixed template is picked up
+	loadErr := t.loadTemplates()
 
 	changeLog := make(map[string]chan bool)
 	if err := filepath.Walk("template", func(path string, info os.FileInfo, err error) error {
@@ -63,6 +76,9 @@ func (t *Template) Run(ctx context.Context) error {
 		}(path, ch)
 	}
 
+	if loadErr != nil {
+		return fmt.Errorf("load templates: %w", loadErr)
+	}
 	if t.List == nil || t.Details == nil || t.NotFound == nil {
 		return fmt.Errorf("templates not loaded")
 	}
@@ -79,18 +95,52 @@ func (t *Template) loadTemplates() error {
 		}
 	}
 
-	templ, err := template.ParseFS(filesystem, "template/common/*.html", "template/*.html")
+	templ, err := template.New("").Funcs(templateFuncs).ParseFS(filesystem, "template/common/*.html", "template/*.html")
+	if err != nil {
+		t.Err = fmt.Errorf("parse files: %w", err)
+		return t.Err
+	}
+
+	hashes, err := scriptHashes(filesystem)
 	if err != nil {
-		return fmt.Errorf("parse files: %w", err)
+		t.Err = fmt.Errorf("hash scripts: %w", err)
+		return t.Err
 	}
 
 	t.List = templ.Lookup("list.html")
 	t.Details = templ.Lookup("details.html")
 	t.NotFound = templ.Lookup("404.html")
+	t.Compare = templ.Lookup("compare.html")
+	t.Dependencies = templ.Lookup("dependencies.html")
+	t.ScriptHashes = hashes
+	t.Err = nil
 
 	return nil
 }
 
+// scriptHashes hashes the inline scripts of the templates, so they are allowed by the CSP without 'unsafe-inline'.
+// The scripts must not contain template actions, otherwise the rendered script doesn't match the hash.
+func scriptHashes(filesystem fs.FS) ([]string, error) {
+	var hashes []string
+	for _, pattern := range []string{"template/common/*.html", "template/*.html"} {
+		files, err := fs.Glob(filesystem, pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			data, err := fs.ReadFile(filesystem, file)
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range inlineScript.FindAllSubmatch(data, -1) {
+				sum := sha256.Sum256(m[1])
+				hashes = append(hashes, fmt.Sprintf("'sha256-%s'", base64.StdEncoding.EncodeToString(sum[:])))
+			}
+		}
+	}
+	return hashes, nil
+}
+
 func watchForFile(ctx context.Context, path string) (chan bool, error) {
 	fi, err := os.Stat(path)
 	if err != nil {